@@ -0,0 +1,270 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+)
+
+// DefaultAnnounceCount - default number of announcement rounds
+const DefaultAnnounceCount = 3
+
+// DefaultAnnounceInterval - default delay between announcement rounds
+const DefaultAnnounceInterval = time.Second
+
+// MaxAnnounceDuration - limit for delays between announcement rounds, hook holds domain lock while announcing
+const MaxAnnounceDuration = 5 * time.Second
+
+// ethernet frame types
+const (
+	etherTypeARP  = 0x0806
+	etherTypeIPv6 = 0x86dd
+)
+
+// ethernet header length
+const etherHeaderLength = 14
+
+// ipv6AllNodes - link-local all-nodes multicast address, destination of unsolicited NA
+var ipv6AllNodes = net.ParseIP("ff02::1")
+
+// PacketSender - sends link layer frames out of interface
+type PacketSender interface {
+	HardwareAddr(dev string) (net.HardwareAddr, error)
+	Send(dev string, frame []byte) error
+}
+
+// RawSocket - PacketSender backed by AF_PACKET raw socket
+type RawSocket struct{}
+
+// HardwareAddr - MAC address of interface
+func (RawSocket) HardwareAddr(dev string) (net.HardwareAddr, error) {
+	iface, err := net.InterfaceByName(dev)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(iface.HardwareAddr) != 6 {
+		return nil, fmt.Errorf("interface '%s' has no ethernet address", dev)
+	}
+
+	return iface.HardwareAddr, nil
+}
+
+// Send - sends complete ethernet frame out of interface
+func (RawSocket) Send(dev string, frame []byte) error {
+	if len(frame) < etherHeaderLength {
+		return fmt.Errorf("frame is shorter than ethernet header")
+	}
+
+	iface, err := net.InterfaceByName(dev)
+	if err != nil {
+		return err
+	}
+
+	// protocol 0, socket only sends and never receives
+	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_RAW, 0)
+	if err != nil {
+		return fmt.Errorf("raw socket: %s", err)
+	}
+	defer syscall.Close(fd)
+
+	addr := &syscall.SockaddrLinklayer{
+		Protocol: htons(binary.BigEndian.Uint16(frame[12:14])),
+		Ifindex:  iface.Index,
+		Halen:    6,
+	}
+	copy(addr.Addr[:], frame[0:6])
+
+	return syscall.Sendto(fd, frame, 0, addr)
+}
+
+// htons - converts short from host to network byte order
+func htons(v uint16) uint16 {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, v)
+
+	return binary.NativeEndian.Uint16(b)
+}
+
+// etherHeader - ethernet header of frame
+func etherHeader(dst, src net.HardwareAddr, etherType uint16) []byte {
+	b := make([]byte, etherHeaderLength)
+	copy(b[0:6], dst)
+	copy(b[6:12], src)
+	binary.BigEndian.PutUint16(b[12:14], etherType)
+
+	return b
+}
+
+// GratuitousARP - broadcast ARP request for own address: sender and target address are both IP
+func GratuitousARP(mac net.HardwareAddr, ip net.IP) ([]byte, error) {
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return nil, fmt.Errorf("'%s' is not IPv4 address", ip)
+	}
+
+	broadcast := net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+
+	arp := make([]byte, 28)
+	binary.BigEndian.PutUint16(arp[0:2], 1)      // hardware type: ethernet
+	binary.BigEndian.PutUint16(arp[2:4], 0x0800) // protocol type: IPv4
+	arp[4] = 6                                   // hardware address length
+	arp[5] = 4                                   // protocol address length
+	binary.BigEndian.PutUint16(arp[6:8], 1)      // operation: request
+	copy(arp[8:14], mac)
+	copy(arp[14:18], ip4)
+	// target hardware address is left zero
+	copy(arp[24:28], ip4)
+
+	return append(etherHeader(broadcast, mac, etherTypeARP), arp...), nil
+}
+
+// UnsolicitedNA - neighbor advertisement of own address to all nodes, with override flag and target link-layer address option,
+// router flag is set when sender routes traffic of address
+func UnsolicitedNA(mac net.HardwareAddr, ip net.IP, router bool) ([]byte, error) {
+	ip16 := ip.To16()
+	if ip16 == nil || ip.To4() != nil {
+		return nil, fmt.Errorf("'%s' is not IPv6 address", ip)
+	}
+
+	// ICMPv6 neighbor advertisement
+	icmp := make([]byte, 32)
+	icmp[0] = 136 // type: neighbor advertisement
+	// code and checksum are zero for now
+	icmp[4] = 0x20 // flags: override
+	if router {
+		icmp[4] |= 0x80 // flags: router
+	}
+	copy(icmp[8:24], ip16)
+	icmp[24] = 2 // option: target link-layer address
+	icmp[25] = 1 // option length in units of 8 bytes
+	copy(icmp[26:32], mac)
+
+	binary.BigEndian.PutUint16(icmp[2:4], icmpv6Checksum(ip16, ipv6AllNodes, icmp))
+
+	// IPv6 header
+	hdr := make([]byte, 40)
+	hdr[0] = 0x60 // version 6
+	binary.BigEndian.PutUint16(hdr[4:6], uint16(len(icmp)))
+	hdr[6] = 58  // next header: ICMPv6
+	hdr[7] = 255 // hop limit, required for neighbor discovery
+	copy(hdr[8:24], ip16)
+	copy(hdr[24:40], ipv6AllNodes)
+
+	// multicast MAC of ff02::1
+	dst := net.HardwareAddr{0x33, 0x33, 0x00, 0x00, 0x00, 0x01}
+
+	frame := etherHeader(dst, mac, etherTypeIPv6)
+	frame = append(frame, hdr...)
+
+	return append(frame, icmp...), nil
+}
+
+// icmpv6Checksum - checksum of ICMPv6 message over IPv6 pseudo header
+func icmpv6Checksum(src, dst net.IP, msg []byte) uint16 {
+	pseudo := make([]byte, 40, 40+len(msg))
+	copy(pseudo[0:16], src.To16())
+	copy(pseudo[16:32], dst.To16())
+	binary.BigEndian.PutUint32(pseudo[32:36], uint32(len(msg)))
+	pseudo[39] = 58 // next header: ICMPv6
+
+	data := append(pseudo, msg...)
+	if len(data)%2 != 0 {
+		data = append(data, 0)
+	}
+
+	var sum uint32
+	for i := 0; i < len(data); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(data[i : i+2]))
+	}
+
+	for sum > 0xffff {
+		sum = (sum >> 16) + (sum & 0xffff)
+	}
+
+	return ^uint16(sum)
+}
+
+// Rounds - number of announcement rounds, default when omitted
+func (a *Announce) Rounds() int {
+	if a.Count == 0 {
+		return DefaultAnnounceCount
+	}
+
+	return int(a.Count)
+}
+
+// IntervalDuration - delay between announcement rounds, default when omitted
+func (a *Announce) IntervalDuration() time.Duration {
+	if a.Interval == 0 {
+		return DefaultAnnounceInterval
+	}
+
+	return time.Duration(a.Interval) * time.Millisecond
+}
+
+// AnnounceAddresses - sends gratuitous ARP for each IPv4 and unsolicited NA for each IPv6 address out of specified interface
+//
+// First round is sent right away, later rounds stop once MaxAnnounceDuration of delays passes or hook is canceled.
+func (s *System) AnnounceAddresses(dev string, ipv4, ipv6 []string, router bool, a *Announce) error {
+	// prefix for errors logging
+	const errPrefix = "announce error:"
+
+	if s.Packets == nil {
+		return fmt.Errorf("%s no packet sender", errPrefix)
+	}
+
+	mac, err := s.Packets.HardwareAddr(dev)
+	if err != nil {
+		return fmt.Errorf("%s %s", errPrefix, err)
+	}
+
+	// frames are built once, every round sends same frames
+	var frames [][]byte
+
+	for _, ip := range ipv4 {
+		frame, err := GratuitousARP(mac, net.ParseIP(ip))
+		if err != nil {
+			return fmt.Errorf("%s %s", errPrefix, err)
+		}
+
+		frames = append(frames, frame)
+	}
+
+	for _, ip := range ipv6 {
+		frame, err := UnsolicitedNA(mac, net.ParseIP(ip), router)
+		if err != nil {
+			return fmt.Errorf("%s %s", errPrefix, err)
+		}
+
+		frames = append(frames, frame)
+	}
+
+	var (
+		round  int
+		waited time.Duration
+	)
+
+	for round = 0; round < a.Rounds(); round++ {
+		if round != 0 {
+			// later rounds only refresh caches, skip them rather than delay hook
+			waited += a.IntervalDuration()
+			if waited > MaxAnnounceDuration || !s.sleep(a.IntervalDuration()) {
+				break
+			}
+		}
+
+		for _, frame := range frames {
+			err = s.Packets.Send(dev, frame)
+			if err != nil {
+				return fmt.Errorf("%s sending to '%s': %s", errPrefix, dev, err)
+			}
+		}
+	}
+
+	s.logger().Debug("addresses announced", "dev", dev, "frames", len(frames), "rounds", round)
+
+	return nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestAnnounceFrames(t *testing.T) {
+	mac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+
+	cases := []struct {
+		caseDescription string
+		build           func(net.HardwareAddr, net.IP) ([]byte, error)
+		ip              string
+		want            string
+		err             string
+	}{
+		{
+			caseDescription: "gratuitous ARP",
+			build:           GratuitousARP,
+			ip:              "195.177.118.111",
+			want: "ffffffffffff" + "020000000001" + "0806" +
+				"0001" + "0800" + "06" + "04" + "0001" +
+				"020000000001" + "c3b1766f" + "000000000000" + "c3b1766f",
+		},
+		{
+			caseDescription: "gratuitous ARP for IPv6 address",
+			build:           GratuitousARP,
+			ip:              "2a02:2278:100:1::1",
+			err:             "is not IPv4 address",
+		},
+		{
+			caseDescription: "unsolicited NA",
+			build:           unsolicitedNA(false),
+			ip:              "2a02:2278:100:1::1",
+			want: "333300000001" + "020000000001" + "86dd" +
+				"60000000" + "0020" + "3a" + "ff" +
+				"2a022278010000010000000000000001" + "ff020000000000000000000000000001" +
+				"88" + "00" + "b9a6" + "20000000" +
+				"2a022278010000010000000000000001" +
+				"02" + "01" + "020000000001",
+		},
+		{
+			caseDescription: "unsolicited NA from router",
+			build:           unsolicitedNA(true),
+			ip:              "2a02:2278:100:1::1",
+			want: "333300000001" + "020000000001" + "86dd" +
+				"60000000" + "0020" + "3a" + "ff" +
+				"2a022278010000010000000000000001" + "ff020000000000000000000000000001" +
+				"88" + "00" + "39a6" + "a0000000" +
+				"2a022278010000010000000000000001" +
+				"02" + "01" + "020000000001",
+		},
+		{
+			caseDescription: "unsolicited NA for IPv4 address",
+			build:           unsolicitedNA(false),
+			ip:              "195.177.118.111",
+			err:             "is not IPv6 address",
+		},
+	}
+
+	for _, testCase := range cases {
+		frame, err := testCase.build(mac, net.ParseIP(testCase.ip))
+		if testCase.err != "" {
+			if err == nil || !strings.Contains(err.Error(), testCase.err) {
+				t.Errorf("TestCase: %s\n Got : %v\n Want: %s\n", testCase.caseDescription, err, testCase.err)
+			}
+
+			continue
+		}
+
+		if err != nil || hex.EncodeToString(frame) != testCase.want {
+			t.Errorf("TestCase: %s\n Got : %x, %v\n Want: %s\n", testCase.caseDescription, frame, err, testCase.want)
+		}
+	}
+}
+
+// unsolicitedNA - UnsolicitedNA with fixed router flag
+func unsolicitedNA(router bool) func(net.HardwareAddr, net.IP) ([]byte, error) {
+	return func(mac net.HardwareAddr, ip net.IP) ([]byte, error) {
+		return UnsolicitedNA(mac, ip, router)
+	}
+}
+
+func TestAnnounceAddresses(t *testing.T) {
+	cases := []struct {
+		caseDescription string
+		announce        *Announce
+		canceled        bool
+		want            []string
+	}{
+		{
+			caseDescription: "defaults",
+			announce:        &Announce{},
+			want: []string{
+				"send bond-wan arp 195.177.118.111",
+				"send bond-wan na 2a02:2278:100:1::1",
+				"sleep 1s",
+				"send bond-wan arp 195.177.118.111",
+				"send bond-wan na 2a02:2278:100:1::1",
+				"sleep 1s",
+				"send bond-wan arp 195.177.118.111",
+				"send bond-wan na 2a02:2278:100:1::1",
+			},
+		},
+		{
+			caseDescription: "single round",
+			announce:        &Announce{Count: 1, Interval: 100},
+			want: []string{
+				"send bond-wan arp 195.177.118.111",
+				"send bond-wan na 2a02:2278:100:1::1",
+			},
+		},
+		{
+			caseDescription: "rounds beyond total delay limit are skipped",
+			announce:        &Announce{Count: 10, Interval: 2000},
+			want: []string{
+				"send bond-wan arp 195.177.118.111",
+				"send bond-wan na 2a02:2278:100:1::1",
+				"sleep 2s",
+				"send bond-wan arp 195.177.118.111",
+				"send bond-wan na 2a02:2278:100:1::1",
+				"sleep 2s",
+				"send bond-wan arp 195.177.118.111",
+				"send bond-wan na 2a02:2278:100:1::1",
+			},
+		},
+		{
+			caseDescription: "canceled hook sends first round only",
+			announce:        &Announce{},
+			canceled:        true,
+			want: []string{
+				"send bond-wan arp 195.177.118.111",
+				"send bond-wan na 2a02:2278:100:1::1",
+			},
+		},
+	}
+
+	defer func(ctx context.Context) { HookContext = ctx }(HookContext)
+
+	for _, testCase := range cases {
+		s, r := NewRecordingSystem(t)
+
+		HookContext = context.Background()
+
+		if testCase.canceled {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			HookContext = ctx
+		}
+
+		err := s.AnnounceAddresses("bond-wan", []string{"195.177.118.111"}, []string{"2a02:2278:100:1::1"}, true, testCase.announce)
+		if err != nil || strings.Join(r.Ops, "\n") != strings.Join(testCase.want, "\n") {
+			t.Errorf("TestCase: %s\n Got :\n%s\n%v\n Want:\n%s\n", testCase.caseDescription, strings.Join(r.Ops, "\n"), err, strings.Join(testCase.want, "\n"))
+		}
+	}
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/netip"
+	"sort"
+)
+
+// BGP message types, RFC 4271
+const (
+	bgpOpen         = 1
+	bgpUpdate       = 2
+	bgpNotification = 3
+	bgpKeepalive    = 4
+)
+
+// BGP path attribute types
+const (
+	bgpAttrOrigin    = 1
+	bgpAttrASPath    = 2
+	bgpAttrNextHop   = 3
+	bgpAttrLocalPref = 5
+	bgpAttrMPReach   = 14
+	bgpAttrMPUnreach = 15
+	bgpAttrAS4Path   = 17
+)
+
+// BGP path attribute flags
+const (
+	bgpFlagOptional   = 0x80
+	bgpFlagTransitive = 0x40
+	bgpFlagExtended   = 0x10
+)
+
+// BGP capability codes, RFC 5492
+const (
+	bgpCapMultiprotocol = 1
+	bgpCapFourOctetAS   = 65
+)
+
+// address family identifiers
+const (
+	afiIPv4     = 1
+	afiIPv6     = 2
+	safiUnicast = 1
+)
+
+// bgpHeaderLength - marker, length and type
+const bgpHeaderLength = 19
+
+// bgpMaxMessageLength - max length of BGP message
+const bgpMaxMessageLength = 4096
+
+// bgpMaxUpdatePrefixes - prefixes per UPDATE, /128 takes 17 bytes, so UPDATE stays well below max length
+const bgpMaxUpdatePrefixes = 100
+
+// bgpASTrans - 2-octet AS number standing in for 4-octet one, RFC 6793
+const bgpASTrans = 23456
+
+// bgpCeaseAdminShutdown - NOTIFICATION `Cease` code with `Administrative Shutdown` subcode
+var bgpCeaseAdminShutdown = []byte{6, 2}
+
+// BGPMessage - BGP message without header
+type BGPMessage struct {
+	Type uint8
+	Body []byte
+}
+
+// Marshal - BGP message with header
+func (m BGPMessage) Marshal() []byte {
+	b := make([]byte, bgpHeaderLength, bgpHeaderLength+len(m.Body))
+	copy(b[0:16], bytes.Repeat([]byte{0xff}, 16))
+	binary.BigEndian.PutUint16(b[16:18], uint16(bgpHeaderLength+len(m.Body)))
+	b[18] = m.Type
+
+	return append(b, m.Body...)
+}
+
+// ReadBGPMessage - reads single BGP message
+func ReadBGPMessage(r io.Reader) (BGPMessage, error) {
+	hdr := make([]byte, bgpHeaderLength)
+
+	_, err := io.ReadFull(r, hdr)
+	if err != nil {
+		return BGPMessage{}, err
+	}
+
+	if !bytes.Equal(hdr[0:16], bytes.Repeat([]byte{0xff}, 16)) {
+		return BGPMessage{}, fmt.Errorf("bad BGP message marker")
+	}
+
+	length := int(binary.BigEndian.Uint16(hdr[16:18]))
+	if length < bgpHeaderLength || length > bgpMaxMessageLength {
+		return BGPMessage{}, fmt.Errorf("bad BGP message length %d", length)
+	}
+
+	body := make([]byte, length-bgpHeaderLength)
+
+	_, err = io.ReadFull(r, body)
+	if err != nil {
+		return BGPMessage{}, err
+	}
+
+	return BGPMessage{Type: hdr[18], Body: body}, nil
+}
+
+// BGPFamily - address family, AFI and SAFI
+type BGPFamily struct {
+	AFI  uint16
+	SAFI uint8
+}
+
+// BGPOpen - OPEN message
+type BGPOpen struct {
+	ASN      uint32
+	HoldTime uint16
+	RouterID netip.Addr
+	// multiprotocol capabilities
+	Families []BGPFamily
+	// 4-octet AS number capability
+	FourOctetAS bool
+}
+
+// Marshal - OPEN message, 4-octet AS number is always advertised as capability
+func (o BGPOpen) Marshal() BGPMessage {
+	var caps []byte
+
+	for _, f := range o.Families {
+		caps = append(caps, bgpCapMultiprotocol, 4, byte(f.AFI>>8), byte(f.AFI), 0, f.SAFI)
+	}
+
+	caps = binary.BigEndian.AppendUint32(append(caps, bgpCapFourOctetAS, 4), o.ASN)
+
+	asn := o.ASN
+	if asn > 0xffff {
+		asn = bgpASTrans
+	}
+
+	body := []byte{4} // version
+	body = binary.BigEndian.AppendUint16(body, uint16(asn))
+	body = binary.BigEndian.AppendUint16(body, o.HoldTime)
+	body = append(body, o.RouterID.AsSlice()...)
+	// optional parameters: single capabilities parameter
+	body = append(body, byte(len(caps)+2), 2, byte(len(caps)))
+	body = append(body, caps...)
+
+	return BGPMessage{Type: bgpOpen, Body: body}
+}
+
+// ParseBGPOpen - decodes OPEN message, peer without multiprotocol capabilities speaks IPv4 unicast only
+func ParseBGPOpen(body []byte) (BGPOpen, error) {
+	if len(body) < 10 {
+		return BGPOpen{}, fmt.Errorf("short BGP OPEN")
+	}
+
+	if body[0] != 4 {
+		return BGPOpen{}, fmt.Errorf("unsupported BGP version %d", body[0])
+	}
+
+	o := BGPOpen{
+		ASN:      uint32(binary.BigEndian.Uint16(body[1:3])),
+		HoldTime: binary.BigEndian.Uint16(body[3:5]),
+		RouterID: netip.AddrFrom4([4]byte(body[5:9])),
+	}
+
+	params := body[10:]
+	if len(params) != int(body[9]) {
+		return BGPOpen{}, fmt.Errorf("bad BGP OPEN parameters length")
+	}
+
+	for len(params) >= 2 {
+		kind, length := params[0], int(params[1])
+		if len(params) < 2+length {
+			return BGPOpen{}, fmt.Errorf("bad BGP OPEN parameter length")
+		}
+
+		value := params[2 : 2+length]
+		params = params[2+length:]
+
+		// capabilities only
+		if kind != 2 {
+			continue
+		}
+
+		for len(value) >= 2 {
+			code, clen := value[0], int(value[1])
+			if len(value) < 2+clen {
+				return BGPOpen{}, fmt.Errorf("bad BGP capability length")
+			}
+
+			capValue := value[2 : 2+clen]
+			value = value[2+clen:]
+
+			switch {
+			case code == bgpCapMultiprotocol && clen == 4:
+				o.Families = append(o.Families, BGPFamily{AFI: binary.BigEndian.Uint16(capValue[0:2]), SAFI: capValue[3]})
+			case code == bgpCapFourOctetAS && clen == 4:
+				o.FourOctetAS = true
+				o.ASN = binary.BigEndian.Uint32(capValue)
+			}
+		}
+	}
+
+	if o.Families == nil {
+		o.Families = []BGPFamily{{AFI: afiIPv4, SAFI: safiUnicast}}
+	}
+
+	return o, nil
+}
+
+// HasFamily - reports whether OPEN advertises address family
+func (o BGPOpen) HasFamily(f BGPFamily) bool {
+	for _, x := range o.Families {
+		if x == f {
+			return true
+		}
+	}
+
+	return false
+}
+
+// BGPPath - path attributes of announced routes
+type BGPPath struct {
+	LocalASN uint32
+	// eBGP prepends local AS, iBGP sets LOCAL_PREF instead
+	External bool
+	// AS numbers are encoded in 4 octets when both speakers support it
+	FourOctetAS bool
+	NextHop4    netip.Addr
+	NextHop6    netip.Addr
+}
+
+// attrs - ORIGIN, AS_PATH, AS4_PATH and LOCAL_PREF path attributes
+func (p BGPPath) attrs() []byte {
+	b := bgpAttr(bgpFlagTransitive, bgpAttrOrigin, []byte{0}) // IGP
+
+	var path []byte
+
+	if p.External {
+		path = []byte{2, 1} // AS_SEQUENCE of single AS
+		if p.FourOctetAS {
+			path = binary.BigEndian.AppendUint32(path, p.LocalASN)
+		} else {
+			asn := p.LocalASN
+			if asn > 0xffff {
+				asn = bgpASTrans
+			}
+
+			path = binary.BigEndian.AppendUint16(path, uint16(asn))
+		}
+	}
+
+	b = append(b, bgpAttr(bgpFlagTransitive, bgpAttrASPath, path)...)
+
+	// 2-octet peer sees AS_TRANS in AS_PATH, real AS number travels in AS4_PATH, RFC 6793 section 4.2.2
+	if p.External && !p.FourOctetAS && p.LocalASN > 0xffff {
+		path4 := binary.BigEndian.AppendUint32([]byte{2, 1}, p.LocalASN)
+		b = append(b, bgpAttr(bgpFlagOptional|bgpFlagTransitive, bgpAttrAS4Path, path4)...)
+	}
+
+	if !p.External {
+		b = append(b, bgpAttr(bgpFlagTransitive, bgpAttrLocalPref, binary.BigEndian.AppendUint32(nil, 100))...)
+	}
+
+	return b
+}
+
+// bgpAttr - encodes path attribute, extended length is used for long values
+func bgpAttr(flags, kind uint8, value []byte) []byte {
+	if len(value) > 0xff {
+		b := []byte{flags | bgpFlagExtended, kind}
+		b = binary.BigEndian.AppendUint16(b, uint16(len(value)))
+
+		return append(b, value...)
+	}
+
+	return append([]byte{flags, kind, byte(len(value))}, value...)
+}
+
+// bgpPrefixes - encodes prefixes as NLRI: length in bits and significant octets of address
+func bgpPrefixes(prefixes []netip.Prefix) []byte {
+	var b []byte
+
+	for _, p := range prefixes {
+		addr := p.Addr().AsSlice()
+		b = append(b, byte(p.Bits()))
+		b = append(b, addr[:(p.Bits()+7)/8]...)
+	}
+
+	return b
+}
+
+// parseBGPPrefixes - decodes NLRI of address family
+func parseBGPPrefixes(b []byte, afi uint16) ([]netip.Prefix, error) {
+	size := 4
+	if afi == afiIPv6 {
+		size = 16
+	}
+
+	var out []netip.Prefix
+
+	for len(b) > 0 {
+		bits := int(b[0])
+		n := (bits + 7) / 8
+
+		if bits > size*8 || len(b) < 1+n {
+			return nil, fmt.Errorf("bad BGP prefix")
+		}
+
+		addr := make([]byte, size)
+		copy(addr, b[1:1+n])
+		b = b[1+n:]
+
+		a, _ := netip.AddrFromSlice(addr)
+		out = append(out, netip.PrefixFrom(a, bits))
+	}
+
+	return out, nil
+}
+
+// splitFamilies - sorted IPv4 and IPv6 prefixes
+func splitFamilies(prefixes []netip.Prefix) ([]netip.Prefix, []netip.Prefix) {
+	var v4, v6 []netip.Prefix
+
+	for _, p := range prefixes {
+		if p.Addr().Is4() {
+			v4 = append(v4, p)
+		} else {
+			v6 = append(v6, p)
+		}
+	}
+
+	for _, list := range [][]netip.Prefix{v4, v6} {
+		sort.Slice(list, func(i, j int) bool {
+			return list[i].String() < list[j].String()
+		})
+	}
+
+	return v4, v6
+}
+
+// chunkPrefixes - splits prefixes into lists of at most bgpMaxUpdatePrefixes
+func chunkPrefixes(prefixes []netip.Prefix) [][]netip.Prefix {
+	var out [][]netip.Prefix
+
+	for len(prefixes) > bgpMaxUpdatePrefixes {
+		out = append(out, prefixes[:bgpMaxUpdatePrefixes])
+		prefixes = prefixes[bgpMaxUpdatePrefixes:]
+	}
+
+	if len(prefixes) != 0 {
+		out = append(out, prefixes)
+	}
+
+	return out
+}
+
+// BuildBGPUpdates - UPDATE messages withdrawing and announcing prefixes, IPv4 in classic NLRI and IPv6 in multiprotocol attributes
+func BuildBGPUpdates(announce, withdraw []netip.Prefix, path BGPPath) []BGPMessage {
+	var out []BGPMessage
+
+	update := func(withdrawn, attrs, nlri []byte) {
+		body := binary.BigEndian.AppendUint16(nil, uint16(len(withdrawn)))
+		body = append(body, withdrawn...)
+		body = binary.BigEndian.AppendUint16(body, uint16(len(attrs)))
+		body = append(body, attrs...)
+		body = append(body, nlri...)
+
+		out = append(out, BGPMessage{Type: bgpUpdate, Body: body})
+	}
+
+	w4, w6 := splitFamilies(withdraw)
+	a4, a6 := splitFamilies(announce)
+
+	for _, chunk := range chunkPrefixes(w4) {
+		update(bgpPrefixes(chunk), nil, nil)
+	}
+
+	for _, chunk := range chunkPrefixes(w6) {
+		value := []byte{0, afiIPv6, safiUnicast}
+		update(nil, bgpAttr(bgpFlagOptional, bgpAttrMPUnreach, append(value, bgpPrefixes(chunk)...)), nil)
+	}
+
+	for _, chunk := range chunkPrefixes(a4) {
+		attrs := append(path.attrs(), bgpAttr(bgpFlagTransitive, bgpAttrNextHop, path.NextHop4.AsSlice())...)
+		update(nil, attrs, bgpPrefixes(chunk))
+	}
+
+	for _, chunk := range chunkPrefixes(a6) {
+		value := []byte{0, afiIPv6, safiUnicast, 16}
+		value = append(value, path.NextHop6.AsSlice()...)
+		value = append(value, 0) // reserved
+		value = append(value, bgpPrefixes(chunk)...)
+
+		update(nil, append(path.attrs(), bgpAttr(bgpFlagOptional, bgpAttrMPReach, value)...), nil)
+	}
+
+	return out
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// BGPRoutes - prefixes announced for running domains, persisted as one JSON file per domain, read by `qemu bgp` daemon
+//
+// BGPRoutes does no locking, hook serializes access per domain with Lock, files are replaced atomically for daemon.
+type BGPRoutes struct {
+	Dir string
+}
+
+// bgpRoutesState - persisted prefixes of domain
+type bgpRoutesState struct {
+	Prefixes []string `json:"Prefixes"`
+}
+
+// path - path to state file for domain
+func (r BGPRoutes) path(uuid string) string {
+	return filepath.Join(filepath.Clean(r.Dir), SanitizeInput(uuid)+".json")
+}
+
+// Announce - sets prefixes announced for domain, replaces previous ones
+func (r BGPRoutes) Announce(uuid string, prefixes []string) error {
+	// prefix for errors logging
+	const errPrefix = "bgp routes error:"
+
+	sort.Strings(prefixes)
+
+	data, err := json.Marshal(bgpRoutesState{Prefixes: prefixes})
+	if err != nil {
+		return fmt.Errorf("%s %s", errPrefix, err)
+	}
+
+	err = os.MkdirAll(filepath.Clean(r.Dir), 0755)
+	if err != nil {
+		return fmt.Errorf("%s %s", errPrefix, err)
+	}
+
+	err = WriteFileAtomic(r.path(uuid), data, 0644)
+	if err != nil {
+		return fmt.Errorf("%s %s", errPrefix, err)
+	}
+
+	return nil
+}
+
+// Withdraw - removes prefixes announced for domain
+func (r BGPRoutes) Withdraw(uuid string) error {
+	err := os.Remove(r.path(uuid))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("bgp routes error: %s", err)
+	}
+
+	return nil
+}
+
+// Domains - UUIDs of domains with announced prefixes, missing directory has no domains
+func (r BGPRoutes) Domains() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Clean(r.Dir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("bgp routes error: %s", err)
+	}
+
+	var out []string
+
+	for _, entry := range entries {
+		// temporary files of atomic writes are hidden
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+
+		out = append(out, strings.TrimSuffix(entry.Name(), ".json"))
+	}
+
+	return out, nil
+}
+
+// All - union of prefixes announced for all domains, missing directory has no prefixes
+func (r BGPRoutes) All() (map[netip.Prefix]bool, error) {
+	// prefix for errors logging
+	const errPrefix = "bgp routes error:"
+
+	entries, err := os.ReadDir(filepath.Clean(r.Dir))
+	if os.IsNotExist(err) {
+		return map[netip.Prefix]bool{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s %s", errPrefix, err)
+	}
+
+	out := make(map[netip.Prefix]bool)
+
+	for _, entry := range entries {
+		// temporary files of atomic writes are hidden
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+
+		path := filepath.Join(filepath.Clean(r.Dir), entry.Name())
+
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			// withdrawn meanwhile
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s %s", errPrefix, err)
+		}
+
+		var state bgpRoutesState
+
+		err = json.Unmarshal(data, &state)
+		if err != nil {
+			return nil, fmt.Errorf("%s '%s': %s", errPrefix, path, err)
+		}
+
+		for _, p := range state.Prefixes {
+			prefix, err := netip.ParsePrefix(p)
+			if err != nil {
+				return nil, fmt.Errorf("%s '%s': %s", errPrefix, path, err)
+			}
+
+			out[prefix.Masked()] = true
+		}
+	}
+
+	return out, nil
+}
+
+// BGPRoutes - prefixes announced for running domains
+func (s *System) BGPRoutes() BGPRoutes {
+	return BGPRoutes{Dir: filepath.Join(s.RunDir, "bgp")}
+}
+
+// AnnounceVMRoutes - announces prefixes of domain by BGP
+func (s *System) AnnounceVMRoutes(uuid string, prefixes []string) error {
+	err := s.BGPRoutes().Announce(uuid, prefixes)
+	if err != nil {
+		s.logger().Error(err.Error())
+
+		return err
+	}
+
+	s.logger().Info("routes announced", "prefixes", len(prefixes))
+
+	return nil
+}
+
+// WithdrawVMRoutes - withdraws prefixes of domain from BGP, domain without announced prefixes is no error
+func (s *System) WithdrawVMRoutes(uuid string) error {
+	err := s.BGPRoutes().Withdraw(uuid)
+	if err != nil {
+		s.logger().Error(err.Error())
+	}
+
+	return err
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBGPRoutes(t *testing.T) {
+	s := &System{RunDir: t.TempDir()}
+	r := s.BGPRoutes()
+
+	prefixes := func(list ...string) map[netip.Prefix]bool {
+		out := make(map[netip.Prefix]bool)
+		for _, p := range list {
+			out[netip.MustParsePrefix(p)] = true
+		}
+
+		return out
+	}
+
+	steps := []struct {
+		caseDescription string
+		withdraw        bool
+		uuid            string
+		prefixes        []string
+		want            map[netip.Prefix]bool
+	}{
+		{"missing directory has no prefixes", true, "vm0", nil, prefixes()},
+		{"first domain announces", false, "vm1", []string{"195.177.118.111/32", "2a02:2278:100:1::/64"}, prefixes("195.177.118.111/32", "2a02:2278:100:1::/64")},
+		{"second domain announces", false, "vm2", []string{"195.177.118.112/32"}, prefixes("195.177.118.111/32", "2a02:2278:100:1::/64", "195.177.118.112/32")},
+		{"repeated announce replaces prefixes", false, "vm1", []string{"195.177.118.111/32"}, prefixes("195.177.118.111/32", "195.177.118.112/32")},
+		{"first domain withdraws", true, "vm1", nil, prefixes("195.177.118.112/32")},
+		{"repeated withdraw is no-op", true, "vm1", nil, prefixes("195.177.118.112/32")},
+	}
+
+	for _, step := range steps {
+		var err error
+
+		if step.withdraw {
+			err = s.WithdrawVMRoutes(step.uuid)
+		} else {
+			err = s.AnnounceVMRoutes(step.uuid, step.prefixes)
+		}
+
+		if err != nil {
+			t.Fatalf("TestCase: %s\n Got : %s\n Want: nil", step.caseDescription, err)
+		}
+
+		got, err := r.All()
+		if err != nil {
+			t.Fatalf("TestCase: %s\n Got : %s\n Want: nil", step.caseDescription, err)
+		}
+
+		if !reflect.DeepEqual(got, step.want) {
+			t.Errorf("TestCase: %s\n Got : %v\n Want: %v\n", step.caseDescription, got, step.want)
+		}
+	}
+
+	// temporary files of atomic writes are ignored
+	err := os.WriteFile(filepath.Join(r.Dir, ".vm3.json.tmp"), []byte("{"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = r.All()
+	if err != nil {
+		t.Errorf("TestCase: temporary file\n Got : %s\n Want: nil", err)
+	}
+}
+
+func TestAnnouncedPrefixes(t *testing.T) {
+	l3 := &L3{
+		IPv4:          []string{"195.177.118.111"},
+		Routes:        []Route{{Prefix: "195.177.118.120/29", Via: "195.177.118.111"}},
+		IPv6:          []string{"2a02:2278:100:2::1"},
+		IPv6Prefix:    "2a02:2278:100:2::/64",
+		IPv6Delegated: []Route6{{Prefix: "2a02:2278:200::/56", Via: "2a02:2278:100:2::1"}},
+	}
+
+	want := []string{"195.177.118.111/32", "195.177.118.120/29", "2a02:2278:100:2::1/128", "2a02:2278:100:2::/64", "2a02:2278:200::/56"}
+
+	if got := l3.AnnouncedPrefixes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("TestCase: all prefix kinds\n Got : %v\n Want: %v\n", got, want)
+	}
+}
@@ -0,0 +1,409 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultBGPHoldTime - hold time proposed to peers, seconds
+const DefaultBGPHoldTime = 90
+
+// DefaultBGPPort - TCP port of peers
+const DefaultBGPPort = 179
+
+// DefaultBGPRetryInterval - delay before reconnecting to peer after session failure
+const DefaultBGPRetryInterval = 10 * time.Second
+
+// DefaultBGPPollInterval - delay between reads of announced prefixes
+const DefaultBGPPollInterval = time.Second
+
+// bgpWriteTimeout - limit for sending single message
+const bgpWriteTimeout = 10 * time.Second
+
+// bgpFamilies - address families advertised to peers
+var bgpFamilies = []BGPFamily{
+	{AFI: afiIPv4, SAFI: safiUnicast},
+	{AFI: afiIPv6, SAFI: safiUnicast},
+}
+
+// BGPSpeaker - announces prefixes of BGPRoutes to every configured peer, one session per peer
+type BGPSpeaker struct {
+	Config BGP
+	Routes BGPRoutes
+	// delay before reconnecting to peer, DefaultBGPRetryInterval when not set
+	RetryInterval time.Duration
+	// delay between reads of Routes, DefaultBGPPollInterval when not set
+	PollInterval time.Duration
+	// global Logger when not set
+	Log *slog.Logger
+}
+
+// logger - returns speaker logger
+func (b *BGPSpeaker) logger() *slog.Logger {
+	if b.Log == nil {
+		return Logger
+	}
+
+	return b.Log
+}
+
+// holdTime - hold time proposed to peers, seconds
+func (b *BGPSpeaker) holdTime() uint16 {
+	if b.Config.HoldTime == 0 {
+		return DefaultBGPHoldTime
+	}
+
+	return uint16(b.Config.HoldTime)
+}
+
+// Run - runs sessions with all peers until context is cancelled, sessions are reestablished after failures
+func (b *BGPSpeaker) Run(ctx context.Context) error {
+	routerID, err := netip.ParseAddr(b.Config.RouterID)
+	if err != nil || !routerID.Is4() {
+		return fmt.Errorf("bgp error: invalid router ID '%s'", b.Config.RouterID)
+	}
+
+	var wg sync.WaitGroup
+
+	for _, peer := range b.Config.Peers {
+		wg.Add(1)
+
+		go func(peer BGPPeer) {
+			defer wg.Done()
+
+			b.runPeer(ctx, peer)
+		}(peer)
+	}
+
+	wg.Wait()
+
+	return nil
+}
+
+// runPeer - keeps session with peer up until context is cancelled
+func (b *BGPSpeaker) runPeer(ctx context.Context, peer BGPPeer) {
+	log := b.logger().With("peer", peer.Address)
+
+	retry := b.RetryInterval
+	if retry == 0 {
+		retry = DefaultBGPRetryInterval
+	}
+
+	for {
+		err := b.session(ctx, peer, log)
+		if ctx.Err() != nil {
+			log.Info("bgp session closed")
+
+			return
+		}
+
+		log.Warn("bgp session down", "error", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retry):
+		}
+	}
+}
+
+// bgpConn - established session
+type bgpConn struct {
+	net.Conn
+}
+
+// send - writes message with write timeout
+func (c bgpConn) send(m BGPMessage) error {
+	err := c.SetWriteDeadline(time.Now().Add(bgpWriteTimeout))
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Write(m.Marshal())
+
+	return err
+}
+
+// receive - reads message, hold time of 0 waits forever
+func (c bgpConn) receive(hold time.Duration) (BGPMessage, error) {
+	deadline := time.Time{}
+	if hold != 0 {
+		deadline = time.Now().Add(hold)
+	}
+
+	err := c.SetReadDeadline(deadline)
+	if err != nil {
+		return BGPMessage{}, err
+	}
+
+	m, err := ReadBGPMessage(c)
+	if err != nil {
+		return m, err
+	}
+
+	if m.Type == bgpNotification {
+		return m, fmt.Errorf("notification from peer: %s", notificationString(m.Body))
+	}
+
+	return m, nil
+}
+
+// notificationString - `code 6 subcode 2`
+func notificationString(body []byte) string {
+	if len(body) < 2 {
+		return "malformed"
+	}
+
+	return fmt.Sprintf("code %d subcode %d", body[0], body[1])
+}
+
+// session - runs single session with peer, returns when session fails or context is cancelled
+func (b *BGPSpeaker) session(ctx context.Context, peer BGPPeer, log *slog.Logger) error {
+	port := peer.Port
+	if port == 0 {
+		port = DefaultBGPPort
+	}
+
+	var dialer net.Dialer
+
+	nc, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(peer.Address, strconv.FormatInt(port, 10)))
+	if err != nil {
+		return err
+	}
+	defer nc.Close()
+
+	conn := bgpConn{nc}
+
+	// OPEN exchange
+	local := BGPOpen{
+		ASN:      uint32(b.Config.ASN),
+		HoldTime: b.holdTime(),
+		RouterID: netip.MustParseAddr(b.Config.RouterID),
+		Families: bgpFamilies,
+	}
+
+	err = conn.send(local.Marshal())
+	if err != nil {
+		return err
+	}
+
+	m, err := conn.receive(time.Duration(local.HoldTime) * time.Second)
+	if err != nil {
+		return err
+	}
+
+	if m.Type != bgpOpen {
+		return fmt.Errorf("expected OPEN, got message type %d", m.Type)
+	}
+
+	remote, err := ParseBGPOpen(m.Body)
+	if err != nil {
+		return err
+	}
+
+	if int64(remote.ASN) != peer.ASN {
+		// Open Message Error, Bad Peer AS
+		_ = conn.send(BGPMessage{Type: bgpNotification, Body: []byte{2, 2}})
+
+		return fmt.Errorf("peer AS %d, expected %d", remote.ASN, peer.ASN)
+	}
+
+	if remote.HoldTime == 1 || remote.HoldTime == 2 {
+		// Open Message Error, Unacceptable Hold Time
+		_ = conn.send(BGPMessage{Type: bgpNotification, Body: []byte{2, 6}})
+
+		return fmt.Errorf("peer hold time %d, must be 0 or at least 3 seconds", remote.HoldTime)
+	}
+
+	// hold time is lower one of both speakers, 0 disables keepalives
+	hold := min(local.HoldTime, remote.HoldTime)
+
+	err = conn.send(BGPMessage{Type: bgpKeepalive})
+	if err != nil {
+		return err
+	}
+
+	// NOTIFICATION is returned as error by receive
+	m, err = conn.receive(time.Duration(local.HoldTime) * time.Second)
+	if err != nil {
+		return err
+	}
+
+	if m.Type != bgpKeepalive {
+		// Finite State Machine Error
+		_ = conn.send(BGPMessage{Type: bgpNotification, Body: []byte{5, 0}})
+
+		return fmt.Errorf("expected KEEPALIVE, got message type %d", m.Type)
+	}
+
+	log.Info("bgp session established", "asn", remote.ASN, "hold_time", hold)
+
+	// path attributes of all announced routes
+	path := BGPPath{
+		LocalASN:    local.ASN,
+		External:    remote.ASN != local.ASN,
+		FourOctetAS: remote.FourOctetAS,
+	}
+
+	path.NextHop4, path.NextHop6 = b.nextHops(nc.LocalAddr())
+
+	// messages from peer are only checked for errors, routes learned from peer are ignored
+	errc := make(chan error, 1)
+
+	go func() {
+		for {
+			_, err := conn.receive(time.Duration(hold) * time.Second)
+			if err != nil {
+				errc <- err
+
+				return
+			}
+		}
+	}()
+
+	var keepalive <-chan time.Time
+
+	if hold != 0 {
+		ticker := time.NewTicker(time.Duration(hold) * time.Second / 3)
+		defer ticker.Stop()
+
+		keepalive = ticker.C
+	}
+
+	pollInterval := b.PollInterval
+	if pollInterval == 0 {
+		pollInterval = DefaultBGPPollInterval
+	}
+
+	poll := time.NewTicker(pollInterval)
+	defer poll.Stop()
+
+	// prefixes announced to peer in this session
+	announced := make(map[netip.Prefix]bool)
+
+	for {
+		err = b.sync(conn, remote, path, announced, log)
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			_ = conn.send(BGPMessage{Type: bgpNotification, Body: bgpCeaseAdminShutdown})
+
+			return ctx.Err()
+		case err = <-errc:
+			return err
+		case <-keepalive:
+			err = conn.send(BGPMessage{Type: bgpKeepalive})
+			if err != nil {
+				return err
+			}
+		case <-poll.C:
+		}
+	}
+}
+
+// nextHops - configured next hops, local address of session for its own family otherwise
+func (b *BGPSpeaker) nextHops(local net.Addr) (netip.Addr, netip.Addr) {
+	var nh4, nh6 netip.Addr
+
+	if tcp, ok := local.(*net.TCPAddr); ok {
+		addr, _ := netip.AddrFromSlice(tcp.IP)
+		addr = addr.Unmap()
+
+		if addr.Is4() {
+			nh4 = addr
+		} else {
+			nh6 = addr
+		}
+	}
+
+	if b.Config.NextHop4 != "" {
+		nh4 = netip.MustParseAddr(b.Config.NextHop4)
+	}
+
+	if b.Config.NextHop6 != "" {
+		nh6 = netip.MustParseAddr(b.Config.NextHop6)
+	}
+
+	return nh4, nh6
+}
+
+// sync - sends UPDATE messages for difference between Routes and prefixes announced to peer
+//
+// Prefixes of family not supported by peer or without next hop are never announced.
+func (b *BGPSpeaker) sync(conn bgpConn, remote BGPOpen, path BGPPath, announced map[netip.Prefix]bool, log *slog.Logger) error {
+	desired, err := b.Routes.All()
+	if err != nil {
+		// keep announced prefixes, rather than withdraw everything on unreadable state
+		log.Error(err.Error())
+
+		return nil
+	}
+
+	// families to announce
+	v4 := remote.HasFamily(BGPFamily{AFI: afiIPv4, SAFI: safiUnicast}) && path.NextHop4.IsValid()
+	v6 := remote.HasFamily(BGPFamily{AFI: afiIPv6, SAFI: safiUnicast}) && path.NextHop6.IsValid()
+
+	var announce, withdraw []netip.Prefix
+
+	for prefix := range desired {
+		if announced[prefix] || (prefix.Addr().Is4() && !v4) || (prefix.Addr().Is6() && !v6) {
+			continue
+		}
+
+		announce = append(announce, prefix)
+	}
+
+	for prefix := range announced {
+		if !desired[prefix] {
+			withdraw = append(withdraw, prefix)
+		}
+	}
+
+	if len(announce) == 0 && len(withdraw) == 0 {
+		return nil
+	}
+
+	// stable order of prefixes in messages
+	sortPrefixes(announce)
+	sortPrefixes(withdraw)
+
+	for _, m := range BuildBGPUpdates(announce, withdraw, path) {
+		err = conn.send(m)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, prefix := range announce {
+		announced[prefix] = true
+	}
+
+	for _, prefix := range withdraw {
+		delete(announced, prefix)
+	}
+
+	log.Info("bgp routes updated", "announced", len(announce), "withdrawn", len(withdraw), "total", len(announced))
+
+	return nil
+}
+
+// sortPrefixes - sorts prefixes by address, then by length
+func sortPrefixes(prefixes []netip.Prefix) {
+	sort.Slice(prefixes, func(i, j int) bool {
+		if c := prefixes[i].Addr().Compare(prefixes[j].Addr()); c != 0 {
+			return c < 0
+		}
+
+		return prefixes[i].Bits() < prefixes[j].Bits()
+	})
+}
@@ -0,0 +1,708 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/netip"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBGPOpen(t *testing.T) {
+	cases := []struct {
+		caseDescription string
+		open            BGPOpen
+	}{
+		{
+			caseDescription: "2-octet AS number",
+			open: BGPOpen{
+				ASN:      65001,
+				HoldTime: 90,
+				RouterID: netip.MustParseAddr("195.177.118.1"),
+				Families: bgpFamilies,
+			},
+		},
+		{
+			caseDescription: "4-octet AS number",
+			open: BGPOpen{
+				ASN:      4200000001,
+				HoldTime: 3,
+				RouterID: netip.MustParseAddr("195.177.118.1"),
+				Families: []BGPFamily{{AFI: afiIPv6, SAFI: safiUnicast}},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		m := tc.open.Marshal()
+
+		got, err := ParseBGPOpen(m.Body)
+		if err != nil {
+			t.Fatalf("TestCase: %s\n Got : %s\n Want: nil", tc.caseDescription, err)
+		}
+
+		// 4-octet AS number capability is always advertised
+		want := tc.open
+		want.FourOctetAS = true
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("TestCase: %s\n Got : %+v\n Want: %+v\n", tc.caseDescription, got, want)
+		}
+	}
+
+	// peer without capabilities speaks IPv4 unicast with 2-octet AS numbers
+	got, err := ParseBGPOpen([]byte{4, 0xfd, 0xe9, 0, 90, 195, 177, 118, 2, 0})
+	if err != nil {
+		t.Fatalf("TestCase: no capabilities\n Got : %s\n Want: nil", err)
+	}
+
+	want := BGPOpen{
+		ASN:      65001,
+		HoldTime: 90,
+		RouterID: netip.MustParseAddr("195.177.118.2"),
+		Families: []BGPFamily{{AFI: afiIPv4, SAFI: safiUnicast}},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("TestCase: no capabilities\n Got : %+v\n Want: %+v\n", got, want)
+	}
+}
+
+func TestBuildBGPUpdates(t *testing.T) {
+	nh4 := netip.MustParseAddr("195.177.118.1")
+	nh6 := netip.MustParseAddr("2a02:2278:100::1")
+
+	cases := []struct {
+		caseDescription string
+		announce        []string
+		withdraw        []string
+		path            BGPPath
+		want            []BGPUpdate
+	}{
+		{
+			caseDescription: "eBGP IPv4 and IPv6 announcement",
+			announce:        []string{"195.177.118.111/32", "195.177.118.120/29", "2a02:2278:200::/56"},
+			path:            BGPPath{LocalASN: 65001, External: true, FourOctetAS: true, NextHop4: nh4, NextHop6: nh6},
+			want: []BGPUpdate{
+				{
+					Announced: prefixList("195.177.118.111/32", "195.177.118.120/29"),
+					ASPath:    []uint32{65001},
+					NextHops:  []netip.Addr{nh4},
+				},
+				{
+					Announced: prefixList("2a02:2278:200::/56"),
+					ASPath:    []uint32{65001},
+					NextHops:  []netip.Addr{nh6},
+				},
+			},
+		},
+		{
+			caseDescription: "iBGP leaves AS_PATH empty",
+			announce:        []string{"195.177.118.111/32"},
+			path:            BGPPath{LocalASN: 65001, NextHop4: nh4},
+			want: []BGPUpdate{
+				{
+					Announced: prefixList("195.177.118.111/32"),
+					NextHops:  []netip.Addr{nh4},
+				},
+			},
+		},
+		{
+			caseDescription: "4-octet AS number to 2-octet peer",
+			announce:        []string{"195.177.118.111/32"},
+			path:            BGPPath{LocalASN: 4200000001, External: true, NextHop4: nh4},
+			want: []BGPUpdate{
+				{
+					Announced: prefixList("195.177.118.111/32"),
+					ASPath:    []uint32{bgpASTrans},
+					AS4Path:   []uint32{4200000001},
+					NextHops:  []netip.Addr{nh4},
+				},
+			},
+		},
+		{
+			caseDescription: "2-octet AS number to 2-octet peer",
+			announce:        []string{"195.177.118.111/32"},
+			path:            BGPPath{LocalASN: 65001, External: true, NextHop4: nh4},
+			want: []BGPUpdate{
+				{
+					Announced: prefixList("195.177.118.111/32"),
+					ASPath:    []uint32{65001},
+					NextHops:  []netip.Addr{nh4},
+				},
+			},
+		},
+		{
+			caseDescription: "4-octet AS number to 4-octet peer",
+			announce:        []string{"195.177.118.111/32"},
+			path:            BGPPath{LocalASN: 4200000001, External: true, FourOctetAS: true, NextHop4: nh4},
+			want: []BGPUpdate{
+				{
+					Announced: prefixList("195.177.118.111/32"),
+					ASPath:    []uint32{4200000001},
+					NextHops:  []netip.Addr{nh4},
+				},
+			},
+		},
+		{
+			caseDescription: "withdrawal",
+			withdraw:        []string{"195.177.118.111/32", "2a02:2278:100:1::1/128"},
+			path:            BGPPath{LocalASN: 65001, External: true, FourOctetAS: true},
+			want: []BGPUpdate{
+				{Withdrawn: prefixList("195.177.118.111/32")},
+				{Withdrawn: prefixList("2a02:2278:100:1::1/128")},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		var got []BGPUpdate
+
+		for _, m := range BuildBGPUpdates(prefixList(tc.announce...), prefixList(tc.withdraw...), tc.path) {
+			if len(m.Marshal()) > bgpMaxMessageLength {
+				t.Errorf("TestCase: %s\n Got : %d bytes message\n Want: at most %d", tc.caseDescription, len(m.Marshal()), bgpMaxMessageLength)
+			}
+
+			u, err := ParseBGPUpdate(m.Body, tc.path.FourOctetAS)
+			if err != nil {
+				t.Fatalf("TestCase: %s\n Got : %s\n Want: nil", tc.caseDescription, err)
+			}
+
+			got = append(got, u)
+		}
+
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("TestCase: %s\n Got : %+v\n Want: %+v\n", tc.caseDescription, got, tc.want)
+		}
+	}
+
+	// long prefix lists are split into several messages
+	var many []netip.Prefix
+	for i := 0; i < 250; i++ {
+		many = append(many, netip.PrefixFrom(netip.AddrFrom16([16]byte{0x2a, 0x02, 15: byte(i)}), 128))
+	}
+
+	if got := len(BuildBGPUpdates(many, nil, BGPPath{NextHop6: nh6})); got != 3 {
+		t.Errorf("TestCase: 250 prefixes\n Got : %d messages\n Want: 3\n", got)
+	}
+}
+
+// BGPUpdate - decoded UPDATE message
+type BGPUpdate struct {
+	Announced []netip.Prefix
+	Withdrawn []netip.Prefix
+	// AS_PATH as list of AS numbers
+	ASPath []uint32
+	// AS4_PATH as list of AS numbers, sent to 2-octet peers only
+	AS4Path  []uint32
+	NextHops []netip.Addr
+}
+
+// ParseBGPUpdate - decodes UPDATE message, for IPv4 and IPv6 unicast
+func ParseBGPUpdate(body []byte, fourOctetAS bool) (BGPUpdate, error) {
+	var u BGPUpdate
+
+	if len(body) < 4 {
+		return u, fmt.Errorf("short BGP UPDATE")
+	}
+
+	wlen := int(binary.BigEndian.Uint16(body[0:2]))
+	if len(body) < 4+wlen {
+		return u, fmt.Errorf("bad BGP UPDATE withdrawn length")
+	}
+
+	withdrawn, err := parseBGPPrefixes(body[2:2+wlen], afiIPv4)
+	if err != nil {
+		return u, err
+	}
+
+	u.Withdrawn = append(u.Withdrawn, withdrawn...)
+
+	body = body[2+wlen:]
+	alen := int(binary.BigEndian.Uint16(body[0:2]))
+
+	if len(body) < 2+alen {
+		return u, fmt.Errorf("bad BGP UPDATE attributes length")
+	}
+
+	attrs, nlri := body[2:2+alen], body[2+alen:]
+
+	for len(attrs) >= 3 {
+		flags, kind := attrs[0], attrs[1]
+
+		var value []byte
+
+		if flags&bgpFlagExtended != 0 {
+			if len(attrs) < 4 {
+				return u, fmt.Errorf("bad BGP attribute")
+			}
+
+			n := int(binary.BigEndian.Uint16(attrs[2:4]))
+			if len(attrs) < 4+n {
+				return u, fmt.Errorf("bad BGP attribute length")
+			}
+
+			value, attrs = attrs[4:4+n], attrs[4+n:]
+		} else {
+			n := int(attrs[2])
+			if len(attrs) < 3+n {
+				return u, fmt.Errorf("bad BGP attribute length")
+			}
+
+			value, attrs = attrs[3:3+n], attrs[3+n:]
+		}
+
+		switch kind {
+		case bgpAttrASPath, bgpAttrAS4Path:
+			size := 2
+			if fourOctetAS || kind == bgpAttrAS4Path {
+				size = 4
+			}
+
+			list := &u.ASPath
+			if kind == bgpAttrAS4Path {
+				list = &u.AS4Path
+			}
+
+			for len(value) >= 2 {
+				n := int(value[1])
+				if len(value) < 2+n*size {
+					return u, fmt.Errorf("bad BGP AS_PATH")
+				}
+
+				for i := 0; i < n; i++ {
+					as := value[2+i*size : 2+(i+1)*size]
+					if size == 4 {
+						*list = append(*list, binary.BigEndian.Uint32(as))
+					} else {
+						*list = append(*list, uint32(binary.BigEndian.Uint16(as)))
+					}
+				}
+
+				value = value[2+n*size:]
+			}
+		case bgpAttrNextHop:
+			nh, ok := netip.AddrFromSlice(value)
+			if ok {
+				u.NextHops = append(u.NextHops, nh)
+			}
+		case bgpAttrMPReach:
+			if len(value) < 5 || len(value) < 5+int(value[3]) {
+				return u, fmt.Errorf("bad BGP MP_REACH_NLRI")
+			}
+
+			afi, nhlen := binary.BigEndian.Uint16(value[0:2]), int(value[3])
+
+			nh, ok := netip.AddrFromSlice(value[4 : 4+min(nhlen, 16)])
+			if ok {
+				u.NextHops = append(u.NextHops, nh)
+			}
+
+			prefixes, err := parseBGPPrefixes(value[5+nhlen:], afi)
+			if err != nil {
+				return u, err
+			}
+
+			u.Announced = append(u.Announced, prefixes...)
+		case bgpAttrMPUnreach:
+			if len(value) < 3 {
+				return u, fmt.Errorf("bad BGP MP_UNREACH_NLRI")
+			}
+
+			prefixes, err := parseBGPPrefixes(value[3:], binary.BigEndian.Uint16(value[0:2]))
+			if err != nil {
+				return u, err
+			}
+
+			u.Withdrawn = append(u.Withdrawn, prefixes...)
+		}
+	}
+
+	announced, err := parseBGPPrefixes(nlri, afiIPv4)
+	if err != nil {
+		return u, err
+	}
+
+	u.Announced = append(u.Announced, announced...)
+
+	return u, nil
+}
+
+// prefixList - parses prefixes, nil for none
+func prefixList(prefixes ...string) []netip.Prefix {
+	var out []netip.Prefix
+	for _, p := range prefixes {
+		out = append(out, netip.MustParsePrefix(p))
+	}
+
+	return out
+}
+
+// bgpTestPeer - accepts single session, answers OPEN and reports UPDATE and NOTIFICATION messages of speaker
+type bgpTestPeer struct {
+	t    *testing.T
+	conn net.Conn
+}
+
+// next - next message of speaker other than KEEPALIVE
+func (p *bgpTestPeer) next() BGPMessage {
+	for {
+		err := p.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if err != nil {
+			p.t.Fatal(err)
+		}
+
+		m, err := ReadBGPMessage(p.conn)
+		if err != nil {
+			p.t.Fatalf("TestCase: read from speaker\n Got : %s\n Want: nil", err)
+		}
+
+		if m.Type != bgpKeepalive {
+			return m
+		}
+	}
+}
+
+// send - sends message to speaker
+func (p *bgpTestPeer) send(m BGPMessage) {
+	_, err := p.conn.Write(m.Marshal())
+	if err != nil {
+		p.t.Fatal(err)
+	}
+}
+
+func TestBGPSpeaker(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("no loopback listener: %s", err)
+	}
+	defer ln.Close()
+
+	routes := BGPRoutes{Dir: t.TempDir()}
+
+	err = routes.Announce("8b5c4a64-4c44-4c4e-9d2d-4f7a1b7e0a01", []string{"195.177.118.111/32", "2a02:2278:100:1::1/128"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr := ln.Addr().(*net.TCPAddr)
+
+	speaker := &BGPSpeaker{
+		Config: BGP{
+			ASN:      65001,
+			RouterID: "195.177.118.1",
+			HoldTime: 3,
+			NextHop6: "2a02:2278:100::1",
+			Peers:    []BGPPeer{{Address: "127.0.0.1", ASN: 65000, Port: int64(addr.Port)}},
+		},
+		Routes:        routes,
+		PollInterval:  10 * time.Millisecond,
+		RetryInterval: 10 * time.Millisecond,
+		Log:           slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+
+	go func() { done <- speaker.Run(ctx) }()
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	peer := &bgpTestPeer{t: t, conn: conn}
+
+	// OPEN of speaker
+	m := peer.next()
+	if m.Type != bgpOpen {
+		t.Fatalf("TestCase: OPEN\n Got : message type %d\n Want: %d", m.Type, bgpOpen)
+	}
+
+	open, err := ParseBGPOpen(m.Body)
+	if err != nil || open.ASN != 65001 || open.HoldTime != 3 {
+		t.Fatalf("TestCase: OPEN\n Got : %+v, %v\n Want: AS 65001, hold time 3", open, err)
+	}
+
+	peer.send(BGPOpen{ASN: 65000, HoldTime: 90, RouterID: netip.MustParseAddr("127.0.0.2"), Families: bgpFamilies}.Marshal())
+	peer.send(BGPMessage{Type: bgpKeepalive})
+
+	// initial announcement, IPv4 next hop is local address of session
+	var got BGPUpdate
+
+	for i := 0; i < 2; i++ {
+		m = peer.next()
+
+		u, err := ParseBGPUpdate(m.Body, true)
+		if err != nil {
+			t.Fatalf("TestCase: announcement\n Got : %s\n Want: nil", err)
+		}
+
+		got.Announced = append(got.Announced, u.Announced...)
+		got.NextHops = append(got.NextHops, u.NextHops...)
+	}
+
+	want := BGPUpdate{
+		Announced: prefixList("195.177.118.111/32", "2a02:2278:100:1::1/128"),
+		NextHops:  []netip.Addr{netip.MustParseAddr("127.0.0.1"), netip.MustParseAddr("2a02:2278:100::1")},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("TestCase: announcement\n Got : %+v\n Want: %+v\n", got, want)
+	}
+
+	// withdrawal after domain is stopped
+	err = routes.Withdraw("8b5c4a64-4c44-4c4e-9d2d-4f7a1b7e0a01")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got = BGPUpdate{}
+
+	for i := 0; i < 2; i++ {
+		u, err := ParseBGPUpdate(peer.next().Body, true)
+		if err != nil {
+			t.Fatalf("TestCase: withdrawal\n Got : %s\n Want: nil", err)
+		}
+
+		got.Withdrawn = append(got.Withdrawn, u.Withdrawn...)
+	}
+
+	want = BGPUpdate{Withdrawn: prefixList("195.177.118.111/32", "2a02:2278:100:1::1/128")}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("TestCase: withdrawal\n Got : %+v\n Want: %+v\n", got, want)
+	}
+
+	// shutdown closes session with Cease
+	cancel()
+
+	m = peer.next()
+	if m.Type != bgpNotification || !reflect.DeepEqual(m.Body, bgpCeaseAdminShutdown) {
+		t.Errorf("TestCase: shutdown\n Got : type %d %v\n Want: type %d %v\n", m.Type, m.Body, bgpNotification, bgpCeaseAdminShutdown)
+	}
+
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Errorf("TestCase: shutdown\n Got : %s\n Want: nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("TestCase: shutdown\n Got : speaker still running\n Want: stopped")
+	}
+}
+
+func TestBGPSpeakerHandshake(t *testing.T) {
+	cases := []struct {
+		caseDescription string
+		holdTime        uint16
+		after           BGPMessage
+		notification    []byte
+		err             string
+	}{
+		{
+			caseDescription: "hold time below 3 seconds",
+			holdTime:        2,
+			notification:    []byte{2, 6},
+			err:             "peer hold time 2",
+		},
+		{
+			caseDescription: "UPDATE instead of KEEPALIVE",
+			holdTime:        90,
+			after:           BGPMessage{Type: bgpUpdate, Body: []byte{0, 0, 0, 0}},
+			notification:    []byte{5, 0},
+			err:             "expected KEEPALIVE, got message type 2",
+		},
+		{
+			caseDescription: "NOTIFICATION instead of KEEPALIVE",
+			holdTime:        90,
+			after:           BGPMessage{Type: bgpNotification, Body: []byte{6, 2}},
+			err:             "notification from peer: code 6 subcode 2",
+		},
+	}
+
+	for _, testCase := range cases {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Skipf("no loopback listener: %s", err)
+		}
+
+		speaker := &BGPSpeaker{
+			Config: BGP{ASN: 65001, RouterID: "195.177.118.1", HoldTime: 3},
+			Routes: BGPRoutes{Dir: t.TempDir()},
+		}
+
+		peerConfig := BGPPeer{Address: "127.0.0.1", ASN: 65000, Port: int64(ln.Addr().(*net.TCPAddr).Port)}
+
+		done := make(chan error, 1)
+
+		go func() {
+			done <- speaker.session(context.Background(), peerConfig, slog.New(slog.NewTextHandler(io.Discard, nil)))
+		}()
+
+		conn, err := ln.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		peer := &bgpTestPeer{t: t, conn: conn}
+
+		_ = peer.next()
+
+		peer.send(BGPOpen{ASN: 65000, HoldTime: testCase.holdTime, RouterID: netip.MustParseAddr("127.0.0.2"), Families: bgpFamilies}.Marshal())
+
+		if testCase.after.Type != 0 {
+			peer.send(testCase.after)
+		}
+
+		if testCase.notification != nil {
+			m := peer.next()
+			if m.Type != bgpNotification || !reflect.DeepEqual(m.Body, testCase.notification) {
+				t.Errorf("TestCase: %s\n Got : type %d %v\n Want: type %d %v\n", testCase.caseDescription, m.Type, m.Body, bgpNotification, testCase.notification)
+			}
+		}
+
+		select {
+		case err = <-done:
+			if err == nil || !strings.Contains(err.Error(), testCase.err) {
+				t.Errorf("TestCase: %s\n Got : %v\n Want: %s\n", testCase.caseDescription, err, testCase.err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("TestCase: %s\n Got : session established\n Want: %s\n", testCase.caseDescription, testCase.err)
+		}
+
+		_ = conn.Close()
+		_ = ln.Close()
+	}
+}
+
+// lockedBuffer - log output shared between speaker goroutines and test
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf strings.Builder
+}
+
+// Write - appends log output
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Write(p)
+}
+
+// String - log output so far
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.String()
+}
+
+// TestBGPSpeakerRealPeer - interoperability check against real BGP implementation (bird, FRR, GoBGP),
+// e.g. `QEMU_HOOK_TEST_BGP_PEER=192.0.2.1:179 QEMU_HOOK_TEST_BGP_PEER_ASN=65000 go test -run RealPeer`,
+// peer must accept session from 4-octet AS 4200000001, or from `QEMU_HOOK_TEST_BGP_ASN` when set
+func TestBGPSpeakerRealPeer(t *testing.T) {
+	addr := os.Getenv("QEMU_HOOK_TEST_BGP_PEER")
+	if addr == "" {
+		t.Skip("QEMU_HOOK_TEST_BGP_PEER is not set")
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	peerPort, err := strconv.ParseInt(port, 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	peerASN, err := strconv.ParseInt(os.Getenv("QEMU_HOOK_TEST_BGP_PEER_ASN"), 10, 64)
+	if err != nil {
+		t.Fatalf("QEMU_HOOK_TEST_BGP_PEER_ASN: %s", err)
+	}
+
+	localASN := int64(4200000001)
+	if v := os.Getenv("QEMU_HOOK_TEST_BGP_ASN"); v != "" {
+		localASN, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			t.Fatalf("QEMU_HOOK_TEST_BGP_ASN: %s", err)
+		}
+	}
+
+	routes := BGPRoutes{Dir: t.TempDir()}
+
+	err = routes.Announce("8b5c4a64-4c44-4c4e-9d2d-4f7a1b7e0a01", []string{"192.0.2.111/32", "2001:db8:100:1::1/128"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var logs lockedBuffer
+
+	speaker := &BGPSpeaker{
+		Config: BGP{
+			ASN:      localASN,
+			RouterID: "192.0.2.100",
+			HoldTime: 9,
+			NextHop6: "2001:db8:100::1",
+			Peers:    []BGPPeer{{Address: host, ASN: peerASN, Port: peerPort}},
+		},
+		Routes:       routes,
+		PollInterval: 100 * time.Millisecond,
+		Log:          slog.New(slog.NewTextHandler(&logs, nil)),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+
+	go func() { done <- speaker.Run(ctx) }()
+
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// session must come up, carry routes and survive withdrawal plus two hold time periods without NOTIFICATION from peer
+	steps := []struct {
+		caseDescription string
+		run             func() error
+		want            string
+	}{
+		{"announcement", func() error { return nil }, "bgp routes updated"},
+		{"withdrawal", func() error { return routes.Withdraw("8b5c4a64-4c44-4c4e-9d2d-4f7a1b7e0a01") }, "total=0"},
+	}
+
+	for _, step := range steps {
+		err = step.run()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		deadline := time.Now().Add(30 * time.Second)
+		for !strings.Contains(logs.String(), step.want) && time.Now().Before(deadline) {
+			time.Sleep(100 * time.Millisecond)
+		}
+
+		if !strings.Contains(logs.String(), step.want) {
+			t.Fatalf("TestCase: %s\n Got :\n%s\n Want: %s", step.caseDescription, logs.String(), step.want)
+		}
+	}
+
+	time.Sleep(18 * time.Second)
+
+	if strings.Contains(logs.String(), "bgp session down") {
+		t.Errorf("TestCase: session\n Got :\n%s\n Want: no session failures", logs.String())
+	}
+}
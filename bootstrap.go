@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+
+	libvirtxml "github.com/libvirt/libvirt-go-xml"
+)
+
+// logContext - attributes added to every log line of this invocation, kept to survive log sink reopening
+var logContext []any
+
+// WithLogContext - adds attributes to every following log line
+func WithLogContext(args ...any) {
+	logContext = append(logContext, args...)
+	Logger = Logger.With(args...)
+}
+
+// OpenLog - opens log sink configured by optional log config
+func OpenLog(paths Paths, cfg *Log) {
+	var err error
+
+	_ = LogSink.Close()
+
+	Logger, LogSink, err = OpenLogSink(cfg, paths.Log)
+	Logger = Logger.With(logContext...)
+
+	if err != nil {
+		Logger.Warn(err.Error())
+	}
+}
+
+// LoadConfig - loads hook config, reopens log sink when config defines one
+func LoadConfig(paths Paths) (*Config, error) {
+	cfg, err := GetConfig(paths.Config)
+	if err != nil {
+		Logger.Error(err.Error())
+
+		return nil, err
+	}
+
+	// main hook config
+	c = cfg
+
+	if cfg.Log != nil {
+		OpenLog(paths, cfg.Log)
+	}
+
+	return cfg, nil
+}
+
+// HookFunc - hook for single libvirt operation, as defined on Config
+type HookFunc func(c *Config, s *System, domCfg *libvirtxml.Domain) error
+
+// RunHook - loads config and runs hook within hook timeout, config errors go through same failure policy as hook errors
+func RunHook(paths Paths, hook HookFunc, domCfg *libvirtxml.Domain) error {
+	cfg, err := LoadConfig(paths)
+	if err != nil {
+		return err
+	}
+
+	// limit total run time of hook invocation, libvirt waits for hook to finish
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.GetTimeouts().HookDuration())
+	defer cancel()
+
+	HookContext = ctx
+
+	return hook(cfg, Sys, domCfg)
+}
@@ -0,0 +1,407 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+
+	libvirtxml "github.com/libvirt/libvirt-go-xml"
+)
+
+// Command - command invoked by operator, as opposed to hook invoked by libvirt
+type Command struct {
+	Usage string
+	Run   func(args []string, paths Paths) error
+}
+
+// Commands - operator commands, keyed by name
+var Commands = map[string]Command{
+	"bgp": {
+		Usage: "run BGP speaker announcing routes of running VMs to peers, until interrupted",
+		Run:   BGPCommand,
+	},
+	"gc": {
+		Usage: "list hook owned resources that belong to no running domain or configured VM, remove them with -remove",
+		Run:   GarbageCollectCommand,
+	},
+	"names": {
+		Usage: "print interface names derived from domain UUID, for use as tap names in domain XML",
+		Run:   NamesCommand,
+	},
+	"schema": {
+		Usage: "print JSON Schema of config file",
+		Run:   SchemaCommand,
+	},
+	"validate": {
+		Usage: "validate hook config",
+		Run:   ValidateCommand,
+	},
+}
+
+// HookOperations - operations passed by libvirt as second argument of hook
+var HookOperations = map[string]bool{
+	"prepare":   true,
+	"start":     true,
+	"started":   true,
+	"stopped":   true,
+	"release":   true,
+	"migrate":   true,
+	"restore":   true,
+	"reconnect": true,
+	"attach":    true,
+}
+
+// IsHookInvocation - reports whether arguments look like libvirt hook invocation: `qemu vm1 prepare begin -`
+func IsHookInvocation(args []string) bool {
+	return len(args) == 5 && HookOperations[args[2]]
+}
+
+// RunCLI - runs operator command, returns process exit code
+func RunCLI(args []string, paths Paths) int {
+	cmd, ok := Commands[args[1]]
+	if !ok {
+		PrintUsage()
+
+		return 2
+	}
+
+	err := cmd.Run(args[2:], paths)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+
+		return 1
+	}
+
+	return 0
+}
+
+// PrintUsage - prints operator commands
+func PrintUsage() {
+	names := make([]string, 0, len(Commands))
+	for name := range Commands {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	fmt.Fprintf(os.Stderr, "usage: %s <command> [-config path] [-log path] [flags]\n\ncommands:\n", os.Args[0])
+
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, Commands[name].Usage)
+	}
+}
+
+// GarbageCollectCommand - `gc [-remove]` command
+func GarbageCollectCommand(args []string, paths Paths) error {
+	fs := flag.NewFlagSet("gc", flag.ContinueOnError)
+	paths.AddFlags(fs)
+	remove := fs.Bool("remove", false, "remove orphaned resources")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	OpenLog(paths, nil)
+
+	cfg, err := LoadConfig(paths)
+	if err != nil {
+		return err
+	}
+
+	// wait for running hook invocations, new ones wait for gc
+	unlock, err := Sys.Lock(GCLockName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	domains, err := GetRunningDomains(LibvirtQemuRunDir)
+	if err != nil {
+		return err
+	}
+
+	owners, err := Sys.GetOwners(domains, cfg)
+	if err != nil {
+		return err
+	}
+
+	inv, err := Sys.GetInventory(cfg.GetRouting())
+	if err != nil {
+		return err
+	}
+
+	orphans := inv.Orphans(owners)
+
+	for _, link := range orphans.Links {
+		fmt.Printf("link\t%s\t%s\n", link.Name, link.Alias)
+	}
+
+	for _, route := range orphans.Routes {
+		if route.Table != "" {
+			fmt.Printf("route%s\t%s\tdev %s table %s\n", route.Family[1:], route.Dst, route.Dev, route.Table)
+
+			continue
+		}
+
+		fmt.Printf("route%s\t%s\tdev %s\n", route.Family[1:], route.Dst, route.Dev)
+	}
+
+	for _, qdisc := range orphans.Qdiscs {
+		fmt.Printf("qdisc\t%s\tdev %s\n", qdisc.Handle, qdisc.Dev)
+	}
+
+	for _, uuid := range orphans.BGP {
+		fmt.Printf("bgp\t%s\n", uuid)
+	}
+
+	if !*remove {
+		return nil
+	}
+
+	Logger.Info("gc: removing orphans",
+		"links", len(orphans.Links),
+		"routes", len(orphans.Routes),
+		"qdiscs", len(orphans.Qdiscs),
+		"bgp", len(orphans.BGP),
+	)
+
+	return Sys.RemoveOrphans(orphans)
+}
+
+// BGPCommand - `bgp` command, config changes take effect after restart
+func BGPCommand(args []string, paths Paths) error {
+	fs := flag.NewFlagSet("bgp", flag.ContinueOnError)
+	paths.AddFlags(fs)
+
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	OpenLog(paths, nil)
+
+	cfg, err := LoadConfig(paths)
+	if err != nil {
+		return err
+	}
+
+	if cfg.BGP == nil {
+		return fmt.Errorf("bgp error: no BGP section in config")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	speaker := &BGPSpeaker{
+		Config: *cfg.BGP,
+		Routes: Sys.BGPRoutes(),
+	}
+
+	Logger.Info("bgp: starting", "asn", cfg.BGP.ASN, "router_id", cfg.BGP.RouterID, "peers", len(cfg.BGP.Peers))
+
+	return speaker.Run(ctx)
+}
+
+// ValidateCommand - `validate [-hostname name] [-machine-id id]` command
+func ValidateCommand(args []string, paths Paths) error {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	paths.AddFlags(fs)
+
+	// config is resolved for current host node, unless other host is given
+	id, err := CurrentHost()
+	if err != nil {
+		return err
+	}
+
+	fs.StringVar(&id.Hostname, "hostname", id.Hostname, "resolve config for host with hostname")
+	fs.StringVar(&id.MachineID, "machine-id", id.MachineID, "resolve config for host with machine-id")
+
+	err = fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := GetHostConfig(paths.Config, id)
+	if err != nil {
+		return err
+	}
+
+	if cfg.Host != nil {
+		fmt.Printf("host\t%s\t%s\n", id, cfg.Host)
+	} else {
+		fmt.Printf("host\t%s\tno host section\n", id)
+	}
+
+	// running domains complete VM config, same as on hook invocation
+	domains, err := GetRunningDomains(LibvirtQemuRunDir)
+	if err != nil {
+		return err
+	}
+
+	return ValidateVMs(os.Stdout, cfg, domains)
+}
+
+// ValidateVMs - validates every VM, running domains resolve to VM with matcher of hook and complete its config
+func ValidateVMs(w io.Writer, cfg *Config, domains []*libvirtxml.Domain) error {
+	names := make([]string, 0, len(cfg.VMs))
+	for name := range cfg.VMs {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	// running domains by VM they resolve to: UUID, name, then Match selectors
+	running := make(map[string][]*libvirtxml.Domain)
+
+	// validate each VM, report its source file and effective config after defaults and profile are applied
+	var failed, checked int
+
+	for _, domCfg := range domains {
+		name, _, err := cfg.FindVM(domCfg)
+		if err != nil {
+			// domains without VM config are not managed by hook
+			if !errors.Is(err, ErrVMNotFound) {
+				failed++
+				checked++
+
+				fmt.Fprintf(w, "domain\t%s\t%s\n", domCfg.Name, err)
+			}
+
+			continue
+		}
+
+		running[name] = append(running[name], domCfg)
+	}
+
+	// report - prints VM config with validation status, label names domain when VM selects it by other key
+	report := func(name, label string, vm VM, err error) error {
+		checked++
+
+		status := "ok"
+		if err != nil {
+			failed++
+
+			status = err.Error()
+		}
+
+		data, err := json.MarshalIndent(vm, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\n%s\n", label, cfg.VMs[name].Source, status, data)
+
+		return nil
+	}
+
+	for _, name := range names {
+		vm := cfg.VMs[name]
+
+		// every running domain selected by VM is checked with its own UUID and domain XML
+		for _, domCfg := range running[name] {
+			label := name
+			if name != domCfg.Name && name != domCfg.UUID {
+				label = fmt.Sprintf("%s[%s]", name, domCfg.Name)
+			}
+
+			effective, err := cfg.EffectiveVM(vm, domCfg)
+			if err == nil {
+				err = cfg.LocateValidation(vm.Source, "VMs."+name, Validate.Struct(effective))
+			}
+
+			err = report(name, label, effective, err)
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(running[name]) != 0 {
+			continue
+		}
+
+		// names are derived from domain UUID, VMs keyed by name are checked with names of nil UUID
+		uuid := name
+		if !IsUUID(uuid) {
+			uuid = NilUUID
+		}
+
+		vm = cfg.Naming.Apply(vm, uuid)
+
+		// taps of bound NICs are known only from domain XML of running domain
+		err := report(name, name, vm, cfg.LocateValidation(vm.Source, "VMs."+name, Validate.StructExcept(vm, BoundTargets(vm)...)))
+		if err != nil {
+			return err
+		}
+	}
+
+	if failed != 0 {
+		return fmt.Errorf("config error: %d of %d check(s) failed", failed, checked)
+	}
+
+	return nil
+}
+
+// SchemaCommand - `schema` command
+func SchemaCommand(args []string, _ Paths) error {
+	fs := flag.NewFlagSet("schema", flag.ContinueOnError)
+
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	schema, err := NewConfigSchema()
+	if err != nil {
+		return err
+	}
+
+	data, err := MarshalSchema(schema)
+	if err != nil {
+		return err
+	}
+
+	_, err = os.Stdout.Write(data)
+
+	return err
+}
+
+// NamesCommand - `names -uuid <uuid>` command
+func NamesCommand(args []string, paths Paths) error {
+	fs := flag.NewFlagSet("names", flag.ContinueOnError)
+	paths.AddFlags(fs)
+	uuid := fs.String("uuid", "", "domain UUID")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if !IsUUID(*uuid) {
+		return fmt.Errorf("names error: invalid domain UUID '%s'", *uuid)
+	}
+
+	cfg, err := GetConfig(paths.Config)
+	if err != nil {
+		return err
+	}
+
+	if cfg.Naming == nil {
+		return fmt.Errorf("names error: no naming scheme in config")
+	}
+
+	templates := cfg.Naming.Templates()
+
+	for _, role := range []string{"Upper", "Source", "Target", "VxLAN"} {
+		fmt.Printf("%s\t%s\n", role, RenderName(templates[role], *uuid))
+	}
+
+	return nil
+}
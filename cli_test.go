@@ -0,0 +1,70 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	libvirtxml "github.com/libvirt/libvirt-go-xml"
+)
+
+func TestValidateVMs(t *testing.T) {
+	runner := func(pattern string) VM {
+		return VM{
+			Match: &Match{Name: pattern},
+			Interface: &Interface{
+				L3: &L3{
+					IPv4: []string{"195.177.118.111"},
+					TC:   &TC{Rate: 250, Burst: 256, Limit: 10240},
+				},
+				Uplink: &Iface{"bond-wan"},
+			},
+		}
+	}
+
+	domains := []*libvirtxml.Domain{
+		{Name: "ci-runner-1", UUID: "8b5c4a64-4c44-4c4e-9d2d-4f7a1b7e0a01"},
+		{Name: "ci-runner-2", UUID: "8b5c4a64-4c44-4c4e-9d2d-4f7a1b7e0a02"},
+		{Name: "unmanaged", UUID: "8b5c4a64-4c44-4c4e-9d2d-4f7a1b7e0a03"},
+	}
+
+	cases := []struct {
+		caseDescription string
+		vms             map[string]VM
+		want            []string
+		err             string
+	}{
+		{
+			caseDescription: "domains selected by Match are checked with own UUID",
+			vms:             map[string]VM{"runners": runner("ci-runner-*")},
+			want: []string{
+				"runners[ci-runner-1]\t\tok",
+				RenderName(DefaultNaming.Upper, "8b5c4a64-4c44-4c4e-9d2d-4f7a1b7e0a01"),
+				"runners[ci-runner-2]\t\tok",
+				RenderName(DefaultNaming.Upper, "8b5c4a64-4c44-4c4e-9d2d-4f7a1b7e0a02"),
+			},
+		},
+		{
+			caseDescription: "ambiguous selection fails",
+			vms:             map[string]VM{"runners": runner("ci-runner-*"), "ci": runner("ci-*")},
+			want:            []string{"domain\tci-runner-1\tambiguous match"},
+			err:             "config error: 2 of 4 check(s) failed",
+		},
+	}
+
+	for _, testCase := range cases {
+		cfg := &Config{Naming: &Naming{}, VMs: testCase.vms}
+
+		var out strings.Builder
+
+		err := ValidateVMs(&out, cfg, domains)
+		if testCase.err == "" && err != nil || testCase.err != "" && (err == nil || err.Error() != testCase.err) {
+			t.Errorf("TestCase: %s\n Got : %v\n Want: %s\n", testCase.caseDescription, err, testCase.err)
+		}
+
+		for _, w := range testCase.want {
+			if !strings.Contains(out.String(), w) {
+				t.Errorf("TestCase: %s\n Got :\n%s\n Want: %s\n", testCase.caseDescription, out.String(), w)
+			}
+		}
+	}
+}
@@ -1,33 +1,59 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"net"
+	"slices"
 	"strconv"
 )
 
-// CreateVxLANInterface - creates VxLAN interface inside host node with specified VNI
-func CreateVxLANInterface(name string, vni int64, dev string) error {
+// CreateVxLANInterface - creates VxLAN interface inside host node with specified VNI, empty local address is chosen by kernel
+func (s *System) CreateVxLANInterface(name string, vni int64, dev string, local string) error {
 	// prefix for errors logging
 	const errPrefix = "vxlan config error:"
 
-	// create VxLAN interface
-	cmd := RunCommand("ip", "link", "add", "name", SanitizeInput(name),
+	args := []string{"link", "add", "name", SanitizeInput(name),
 		"type", "vxlan", "id", strconv.FormatInt(vni, 10),
 		"dev", SanitizeInput(dev),
 		"group", "239.0.0.1", "dstport", "4789",
-	)
+	}
+
+	if local != "" {
+		args = append(args, "local", SanitizeInput(local))
+	}
+
+	// create VxLAN interface
+	cmd := s.run("ip", args...)
 	if cmd.ReturnCode != 0 && cmd.ReturnCode != 2 { // return code 2 is for RTNETLINK answers: File exists
-		e := fmt.Errorf("%s running command '%s' failed with exit code '%d', output '%s'", errPrefix, cmd.Command, cmd.ReturnCode, cmd.CombinedOutput)
-		Logger.Println(e)
+		e := cmd.Error(errPrefix)
+		s.logger().Error(e.Error())
+
+		return e
+	}
+
+	// tag VxLAN interface as shared hook resource, bring it to UP state
+	cmd = s.run("ip", "link", "set", "dev", SanitizeInput(name), "alias", Marker{}.String(), "up")
+	if cmd.ReturnCode != 0 {
+		e := cmd.Error(errPrefix)
+		s.logger().Error(e.Error())
 
 		return e
 	}
 
-	// bring VxLAN interface to UP state
-	cmd = RunCommand("ip", "link", "set", "dev", SanitizeInput(name), "up")
+	return nil
+}
+
+// DestroyVxLANInterface - deletes previosly created VxLAN interface
+func (s *System) DestroyVxLANInterface(name string) error {
+	// prefix for errors logging
+	const errPrefix = "vxlan config error:"
+
+	// remove interface
+	cmd := s.run("ip", "link", "del", SanitizeInput(name), "type", "vxlan")
 	if cmd.ReturnCode != 0 {
-		e := fmt.Errorf("%s running command '%s' failed with exit code '%d', output '%s'", errPrefix, cmd.Command, cmd.ReturnCode, cmd.CombinedOutput)
-		Logger.Println(e)
+		e := cmd.Error(errPrefix)
+		s.logger().Error(e.Error())
 
 		return e
 	}
@@ -35,34 +61,125 @@ func CreateVxLANInterface(name string, vni int64, dev string) error {
 	return nil
 }
 
-// CreateVethInterface - creates Veth pair interface inside host node
-func CreateVethInterface(upper, lower string) error {
+// AcquireVxLANInterface - registers domain as user of shared VxLAN interface, creates interface on first use
+func (s *System) AcquireVxLANInterface(name string, vni int64, dev string, local string, user string) error {
+	// serialize with concurrent hook invocations sharing same VxLAN interface
+	unlock, err := s.Lock("link:" + SanitizeInput(name))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	first, err := s.Refs().Acquire(name, user)
+	if err != nil {
+		s.logger().Error(err.Error())
+
+		return err
+	}
+
+	// interface is already created by other user
+	if !first && s.IsInterfaceExists(name) {
+		return nil
+	}
+
+	return s.CreateVxLANInterface(name, vni, dev, local)
+}
+
+// ReleaseVxLANInterface - unregisters domain as user of shared VxLAN interface, deletes interface when last user is released
+func (s *System) ReleaseVxLANInterface(name string, user string) error {
+	// serialize with concurrent hook invocations sharing same VxLAN interface
+	unlock, err := s.Lock("link:" + SanitizeInput(name))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	last, err := s.Refs().Release(name, user)
+	if err != nil {
+		s.logger().Error(err.Error())
+
+		return err
+	}
+
+	// interface is still used by other users, or is already gone
+	if !last || !s.IsInterfaceExists(name) {
+		return nil
+	}
+
+	return s.DestroyVxLANInterface(name)
+}
+
+// ReleaseVxLANInterfaces - unregisters domain as user of every shared VxLAN interface, deletes interfaces left without users
+func (s *System) ReleaseVxLANInterfaces(user string) error {
+	names, err := s.Refs().Devices()
+	if err != nil {
+		s.logger().Error(err.Error())
+
+		return err
+	}
+
+	for _, name := range names {
+		users, err := s.Refs().Users(name)
+		if err != nil {
+			s.logger().Error(err.Error())
+
+			return err
+		}
+
+		if !slices.Contains(users, user) {
+			continue
+		}
+
+		err = s.ReleaseVxLANInterface(name, user)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CreateVethInterface - creates Veth pair interface inside host node, both peers are tagged with owner marker
+func (s *System) CreateVethInterface(upper, lower string, owner Marker) error {
 	// prefix for errors logging
 	const errPrefix = "veth config error:"
 
 	// create Veth interface
-	cmd := RunCommand("ip", "link", "add", "name", SanitizeInput(upper), "type", "veth", "peer", "name", SanitizeInput(lower))
+	cmd := s.run("ip", "link", "add", "name", SanitizeInput(upper), "type", "veth", "peer", "name", SanitizeInput(lower))
 	if cmd.ReturnCode != 0 && cmd.ReturnCode != 2 { // return code 2 is for RTNETLINK answers: File exists
-		e := fmt.Errorf("%s running command '%s' failed with exit code '%d', output '%s'", errPrefix, cmd.Command, cmd.ReturnCode, cmd.CombinedOutput)
-		Logger.Println(e)
+		e := cmd.Error(errPrefix)
+		s.logger().Error(e.Error())
 
 		return e
 	}
 
-	// bring upper veth pair to UP state
-	cmd = RunCommand("ip", "link", "set", "dev", SanitizeInput(upper), "up")
+	// existing links are reused only when owned by same domain, never taken over from other domain
+	if cmd.ReturnCode == 2 {
+		for _, dev := range []string{upper, lower} {
+			err := s.CheckInterfaceOwner(dev, owner)
+			if err != nil {
+				e := fmt.Errorf("%s %s", errPrefix, err)
+				s.logger().Error(e.Error())
+
+				return e
+			}
+		}
+	}
+
+	// tag upper veth pair with owner marker, bring it to UP state
+	cmd = s.run("ip", "link", "set", "dev", SanitizeInput(upper), "alias", owner.String(), "up")
 	if cmd.ReturnCode != 0 {
-		e := fmt.Errorf("%s running command '%s' failed with exit code '%d', output '%s'", errPrefix, cmd.Command, cmd.ReturnCode, cmd.CombinedOutput)
-		Logger.Println(e)
+		e := cmd.Error(errPrefix)
+		s.logger().Error(e.Error())
 
 		return e
 	}
 
-	// bring lower veth pair to UP state
-	cmd = RunCommand("ip", "link", "set", "dev", SanitizeInput(lower), "up")
+	// tag lower veth pair with owner marker, bring it to UP state
+	cmd = s.run("ip", "link", "set", "dev", SanitizeInput(lower), "alias", owner.String(), "up")
 	if cmd.ReturnCode != 0 {
-		e := fmt.Errorf("%s running command '%s' failed with exit code '%d', output '%s'", errPrefix, cmd.Command, cmd.ReturnCode, cmd.CombinedOutput)
-		Logger.Println(e)
+		e := cmd.Error(errPrefix)
+		s.logger().Error(e.Error())
 
 		return e
 	}
@@ -70,25 +187,59 @@ func CreateVethInterface(upper, lower string) error {
 	return nil
 }
 
+// CheckInterfaceOwner - fails when existing link carries marker of other owner or alias not set by hook, missing link and link without alias pass,
+// final backstop for name collisions Naming.Check cannot see before UUID is known
+func (s *System) CheckInterfaceOwner(dev string, owner Marker) error {
+	cmd := s.run("ip", "-j", "link", "show", "dev", SanitizeInput(dev))
+	if cmd.ReturnCode != 0 {
+		return nil
+	}
+
+	var links []LinkInfo
+
+	err := json.Unmarshal(cmd.CombinedOutput, &links)
+	if err != nil {
+		return fmt.Errorf("decoding output of '%s': %s", cmd.Command, err)
+	}
+
+	for _, link := range links {
+		// link created by interrupted hook invocation, before marker was set
+		if link.Alias == "" {
+			continue
+		}
+
+		marker, ok := ParseMarker(link.Alias)
+		if !ok {
+			return fmt.Errorf("link '%s' exists and is not owned by hook, alias '%s'", dev, link.Alias)
+		}
+
+		if marker.UUID != owner.UUID {
+			return fmt.Errorf("link '%s' is owned by other domain, marker '%s'", dev, link.Alias)
+		}
+	}
+
+	return nil
+}
+
 // DestroyVethInterface - deletes previosly created Veth interface
-func DestroyVethInterface(dev string) error {
+func (s *System) DestroyVethInterface(dev string) error {
 	// prefix for errors logging
 	const errPrefix = "veth config error:"
 
 	// get extended information previosly created interface
-	cmd := RunCommand("ip", "-o", "-d", "l", "show", SanitizeInput(dev), "type", "veth")
+	cmd := s.run("ip", "-o", "-d", "l", "show", SanitizeInput(dev), "type", "veth")
 	if cmd.ReturnCode != 0 {
-		e := fmt.Errorf("%s running command '%s' failed with exit code '%d', output '%s'", errPrefix, cmd.Command, cmd.ReturnCode, cmd.CombinedOutput)
-		Logger.Println(e)
+		e := cmd.Error(errPrefix)
+		s.logger().Error(e.Error())
 
 		return e
 	}
 
 	// remove interface
-	cmd = RunCommand("ip", "link", "del", SanitizeInput(dev), "type", "veth")
+	cmd = s.run("ip", "link", "del", SanitizeInput(dev), "type", "veth")
 	if cmd.ReturnCode != 0 {
-		e := fmt.Errorf("%s running command '%s' failed with exit code '%d', output '%s'", errPrefix, cmd.Command, cmd.ReturnCode, cmd.CombinedOutput)
-		Logger.Println(e)
+		e := cmd.Error(errPrefix)
+		s.logger().Error(e.Error())
 
 		return e
 	}
@@ -97,15 +248,55 @@ func DestroyVethInterface(dev string) error {
 }
 
 // AddStaticV4Route - adds static route for IPv4/32 to specified interface
-func AddStaticV4Route(ip string, dev string) error {
+func (s *System) AddStaticV4Route(ip string, dev string, rt Routing) error {
 	// prefix for errors logging
 	const errPrefix = "route4 config error:"
 
+	args := append([]string{"-4", "route", "add", fmt.Sprintf("%s/32", SanitizeInput(ip)), "dev", SanitizeInput(dev)}, rt.AddArgs4()...)
+
 	// add static v4 route
-	cmd := RunCommand("ip", "-4", "route", "add", fmt.Sprintf("%s/32", SanitizeInput(ip)), "dev", SanitizeInput(dev))
+	cmd := s.run("ip", args...)
 	if cmd.ReturnCode != 0 && cmd.ReturnCode != 2 { // return code 2 is for RTNETLINK answers: File exists
-		e := fmt.Errorf("%s running command '%s' failed with exit code '%d', output '%s'", errPrefix, cmd.Command, cmd.ReturnCode, cmd.CombinedOutput)
-		Logger.Println(e)
+		e := cmd.Error(errPrefix)
+		s.logger().Error(e.Error())
+
+		return e
+	}
+
+	return nil
+}
+
+// AddRoutedV4Prefix - adds static route for IPv4 prefix via VM address on specified interface
+func (s *System) AddRoutedV4Prefix(prefix string, via string, dev string, rt Routing) error {
+	// prefix for errors logging
+	const errPrefix = "route4 config error:"
+
+	args := append([]string{"-4", "route", "add", SanitizeInput(prefix), "via", SanitizeInput(via), "dev", SanitizeInput(dev)}, rt.AddArgs4()...)
+
+	// add static v4 route, next hop is reachable by host route to VM address
+	cmd := s.run("ip", args...)
+	if cmd.ReturnCode != 0 && cmd.ReturnCode != 2 { // return code 2 is for RTNETLINK answers: File exists
+		e := cmd.Error(errPrefix)
+		s.logger().Error(e.Error())
+
+		return e
+	}
+
+	return nil
+}
+
+// DelRoutedV4Prefix - deletes static route for IPv4 prefix via VM address on specified interface
+func (s *System) DelRoutedV4Prefix(prefix string, via string, dev string, rt Routing) error {
+	// prefix for errors logging
+	const errPrefix = "route4 config error:"
+
+	args := append([]string{"-4", "route", "del", SanitizeInput(prefix), "via", SanitizeInput(via), "dev", SanitizeInput(dev)}, rt.MatchArgs()...)
+
+	// delete static v4 route
+	cmd := s.run("ip", args...)
+	if cmd.ReturnCode != 0 && cmd.ReturnCode != 2 { // return code 2 is for RTNETLINK answers: No such process
+		e := cmd.Error(errPrefix)
+		s.logger().Error(e.Error())
 
 		return e
 	}
@@ -114,15 +305,93 @@ func AddStaticV4Route(ip string, dev string) error {
 }
 
 // AddStaticV6Route - adds static route for IPv6/128 to specified interface
-func AddStaticV6Route(ip string, dev string) error {
+func (s *System) AddStaticV6Route(ip string, dev string, rt Routing) error {
 	// prefix for errors logging
 	const errPrefix = "route6 config error:"
 
+	args := append([]string{"-6", "route", "add", fmt.Sprintf("%s/128", SanitizeInput(ip)), "dev", SanitizeInput(dev)}, rt.AddArgs6()...)
+
 	// add static v6 route
-	cmd := RunCommand("ip", "-6", "route", "add", fmt.Sprintf("%s/128", SanitizeInput(ip)), "dev", SanitizeInput(dev))
+	cmd := s.run("ip", args...)
+	if cmd.ReturnCode != 0 && cmd.ReturnCode != 2 { // return code 2 is for RTNETLINK answers: File exists
+		e := cmd.Error(errPrefix)
+		s.logger().Error(e.Error())
+
+		return e
+	}
+
+	return nil
+}
+
+// AddOnLinkV6Prefix - adds static route for IPv6 on-link prefix to specified interface
+func (s *System) AddOnLinkV6Prefix(prefix string, dev string, rt Routing) error {
+	// prefix for errors logging
+	const errPrefix = "route6 config error:"
+
+	args := append([]string{"-6", "route", "add", SanitizeInput(prefix), "dev", SanitizeInput(dev)}, rt.AddArgs6()...)
+
+	// add static v6 route, whole prefix is reachable on link
+	cmd := s.run("ip", args...)
 	if cmd.ReturnCode != 0 && cmd.ReturnCode != 2 { // return code 2 is for RTNETLINK answers: File exists
-		e := fmt.Errorf("%s running command '%s' failed with exit code '%d', output '%s'", errPrefix, cmd.Command, cmd.ReturnCode, cmd.CombinedOutput)
-		Logger.Println(e)
+		e := cmd.Error(errPrefix)
+		s.logger().Error(e.Error())
+
+		return e
+	}
+
+	return nil
+}
+
+// DelOnLinkV6Prefix - deletes static route for IPv6 on-link prefix to specified interface
+func (s *System) DelOnLinkV6Prefix(prefix string, dev string, rt Routing) error {
+	// prefix for errors logging
+	const errPrefix = "route6 config error:"
+
+	args := append([]string{"-6", "route", "del", SanitizeInput(prefix), "dev", SanitizeInput(dev)}, rt.MatchArgs()...)
+
+	// delete static v6 route
+	cmd := s.run("ip", args...)
+	if cmd.ReturnCode != 0 && cmd.ReturnCode != 2 { // return code 2 is for RTNETLINK answers: No such process
+		e := cmd.Error(errPrefix)
+		s.logger().Error(e.Error())
+
+		return e
+	}
+
+	return nil
+}
+
+// AddRoutedV6Prefix - adds static route for IPv6 prefix via VM address on specified interface
+func (s *System) AddRoutedV6Prefix(prefix string, via string, dev string, rt Routing) error {
+	// prefix for errors logging
+	const errPrefix = "route6 config error:"
+
+	args := append([]string{"-6", "route", "add", SanitizeInput(prefix), "via", SanitizeInput(via), "dev", SanitizeInput(dev)}, rt.AddArgs6()...)
+
+	// add static v6 route, next hop is reachable by on-link or host route to VM address
+	cmd := s.run("ip", args...)
+	if cmd.ReturnCode != 0 && cmd.ReturnCode != 2 { // return code 2 is for RTNETLINK answers: File exists
+		e := cmd.Error(errPrefix)
+		s.logger().Error(e.Error())
+
+		return e
+	}
+
+	return nil
+}
+
+// DelRoutedV6Prefix - deletes static route for IPv6 prefix via VM address on specified interface
+func (s *System) DelRoutedV6Prefix(prefix string, via string, dev string, rt Routing) error {
+	// prefix for errors logging
+	const errPrefix = "route6 config error:"
+
+	args := append([]string{"-6", "route", "del", SanitizeInput(prefix), "via", SanitizeInput(via), "dev", SanitizeInput(dev)}, rt.MatchArgs()...)
+
+	// delete static v6 route
+	cmd := s.run("ip", args...)
+	if cmd.ReturnCode != 0 && cmd.ReturnCode != 2 { // return code 2 is for RTNETLINK answers: No such process
+		e := cmd.Error(errPrefix)
+		s.logger().Error(e.Error())
 
 		return e
 	}
@@ -131,18 +400,90 @@ func AddStaticV6Route(ip string, dev string) error {
 }
 
 // AddVMGatewayForIPv6 - adds network address computed from IPv6/64 network ad gateway for V6 routing used in VM
-func AddVMGatewayForIPv6(ip string, dev string) error {
+func (s *System) AddVMGatewayForIPv6(ip string, dev string) error {
 	// prefix for errors logging
 	const errPrefix = "vmgw6 config error:"
 
 	// add IPv6 address to device, for VM usage as gateway, used for v6 routing
-	cmd := RunCommand("ip", "-6", "addr", "add", fmt.Sprintf("%s/64", GetNetworkAddressFromIPv6(SanitizeInput(ip))),
+	cmd := s.run("ip", "-6", "addr", "add", fmt.Sprintf("%s/64", GetNetworkAddressFromIPv6(SanitizeInput(ip))),
 		"dev", SanitizeInput(dev),
 		"noprefixroute", "nodad", "scope", "link",
 	)
 	if cmd.ReturnCode != 0 && cmd.ReturnCode != 2 { // return code 2 is for RTNETLINK answers: File exists
-		e := fmt.Errorf("%s running command '%s' failed with exit code '%d', output '%s'", errPrefix, cmd.Command, cmd.ReturnCode, cmd.CombinedOutput)
-		Logger.Println(e)
+		e := cmd.Error(errPrefix)
+		s.logger().Error(e.Error())
+
+		return e
+	}
+
+	return nil
+}
+
+// AddLinkLocalGatewayV4 - adds proxy ARP entry for fixed IPv4 link-local gateway of VM on specified interface
+//
+// Gateway address is not assigned to interface, so host services bound to any address stay unreachable at it.
+// ARP replies carry gateway address, host traffic to VM uses source address of route to VM, like in `proxy-arp` model.
+func (s *System) AddLinkLocalGatewayV4(dev string) error {
+	return s.AddProxyNeighbor(LinkLocalGatewayV4, dev)
+}
+
+// AddLinkLocalGatewayV6 - adds fixed IPv6 link-local gateway address of VM to specified interface
+func (s *System) AddLinkLocalGatewayV6(dev string) error {
+	// prefix for errors logging
+	const errPrefix = "vmgw6 config error:"
+
+	// add IPv6 address to device, for VM usage as gateway, network address stays free for VM
+	cmd := s.run("ip", "-6", "addr", "add", LinkLocalGatewayV6+"/64",
+		"dev", SanitizeInput(dev),
+		"noprefixroute", "nodad",
+	)
+	if cmd.ReturnCode != 0 && cmd.ReturnCode != 2 { // return code 2 is for RTNETLINK answers: File exists
+		e := cmd.Error(errPrefix)
+		s.logger().Error(e.Error())
+
+		return e
+	}
+
+	return nil
+}
+
+// AddProxyNeighbor - adds proxy ARP/NDP entry for VM address on specified interface
+func (s *System) AddProxyNeighbor(ip string, dev string) error {
+	// prefix for errors logging
+	const errPrefix = "neigh config error:"
+
+	family := "-4"
+	if net.ParseIP(ip).To4() == nil {
+		family = "-6"
+	}
+
+	// interface answers ARP/NS for address routed to VM
+	cmd := s.run("ip", family, "neigh", "add", "proxy", SanitizeInput(ip), "dev", SanitizeInput(dev))
+	if cmd.ReturnCode != 0 && cmd.ReturnCode != 2 { // return code 2 is for RTNETLINK answers: File exists
+		e := cmd.Error(errPrefix)
+		s.logger().Error(e.Error())
+
+		return e
+	}
+
+	return nil
+}
+
+// DelProxyNeighbor - deletes proxy ARP/NDP entry for VM address on specified interface
+func (s *System) DelProxyNeighbor(ip string, dev string) error {
+	// prefix for errors logging
+	const errPrefix = "neigh config error:"
+
+	family := "-4"
+	if net.ParseIP(ip).To4() == nil {
+		family = "-6"
+	}
+
+	// delete proxy entry
+	cmd := s.run("ip", family, "neigh", "del", "proxy", SanitizeInput(ip), "dev", SanitizeInput(dev))
+	if cmd.ReturnCode != 0 && cmd.ReturnCode != 2 { // return code 2 is for RTNETLINK answers: No such file or directory
+		e := cmd.Error(errPrefix)
+		s.logger().Error(e.Error())
 
 		return e
 	}
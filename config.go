@@ -1,14 +1,40 @@
 package main
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	validator "gopkg.in/go-playground/validator.v9"
 )
 
 // VM - config per VM
 type VM struct {
+	// name of profile in `Profiles`, applied over `Defaults`
+	Profile string `json:"Profile"`
+	// selects domains by pattern or label, for VMs not keyed by domain UUID or name
+	Match     *Match     `json:"Match" validate:"omitempty"`
 	Interface *Interface `json:"Interface" validate:"required"`
+	// config file defining VM, for error reporting
+	Source string `json:"-"`
+}
+
+// Match - domain selector, all set fields must match
+type Match struct {
+	// shell glob on domain name, e.g. `ci-runner-*`
+	Name string `json:"Name" validate:"omitempty,glob"`
+	// regular expression on whole domain name
+	NameRegex string `json:"NameRegex" validate:"omitempty,regexp"`
+	// MAC address of any domain interface
+	MAC string `json:"MAC" validate:"omitempty,mac"`
+	// shell glob on domain `<title>`
+	Title string `json:"Title" validate:"omitempty,glob"`
+	// label in hook namespace of domain `<metadata>`
+	Label string `json:"Label" validate:"omitempty"`
 }
 
 // Interface - interfaces configuration for VM
@@ -22,11 +48,15 @@ type Interface struct {
 type VxLAN struct {
 	// assume that VNI == 0, no VxLAN
 	VNI int64 `json:"VNI" validate:"required,min=1,max=16777214"`
+	// local address of VxLAN tunnel, usually set per host
+	Local string `json:"Local" validate:"omitempty,ip"`
 	// usually uplink
 	Source *Iface `json:"Source" validate:"required"`
 	// created by libvirt
 	Target *Iface `json:"Target" validate:"required"`
 	TC     *TC    `json:"TC" validate:"required"`
+	// binds Target to domain interface, tap name is taken from domain XML
+	NIC *NIC `json:"NIC" validate:"omitempty"`
 }
 
 // L3 - Internet configuration for VM
@@ -40,6 +70,60 @@ type L3 struct {
 	TC     *TC      `json:"TC" validate:"required"`
 	IPv4   []string `json:"IPv4" validate:"required,unique,dive,ipv4"`
 	IPv6   []string `json:"IPv6" validate:"unique,dive,ipv6,notGW6"`
+	// prefixes routed to VM, installed after host routes of IPv4
+	Routes []Route `json:"Routes" validate:"omitempty,unique,dive"`
+	// on-link /64 routed to upper peer, VM takes its addresses from it
+	IPv6Prefix string `json:"IPv6Prefix" validate:"omitempty,cidrv6"`
+	// prefixes delegated to VM, e.g. /56 or /48, routed via VM address
+	IPv6Delegated []Route6 `json:"IPv6Delegated" validate:"omitempty,unique,dive"`
+	// gateway models of VM, current ones by default
+	Gateway *Gateway `json:"Gateway" validate:"omitempty"`
+	// gratuitous ARP and unsolicited NA for VM addresses out of `Uplink` on start, not sent when omitted
+	Announce *Announce `json:"Announce" validate:"omitempty"`
+	// `uplink`: proxy ARP/NDP entries for each VM address on `Uplink`, for on-link provider networks, `none` by default
+	ProxyNeighbors string `json:"ProxyNeighbors" validate:"omitempty,oneof=none uplink"`
+	// binds Target to domain interface, tap name is taken from domain XML
+	NIC *NIC `json:"NIC" validate:"omitempty"`
+}
+
+// Gateway - how VM reaches its gateway, per address family
+type Gateway struct {
+	// `proxy-arp` (default): upper peer answers ARP for every address, `link-local`: VM uses 169.254.0.1 answered by proxy ARP entry on upper peer
+	IPv4 string `json:"IPv4" validate:"omitempty,oneof=proxy-arp link-local"`
+	// `network` (default): VM uses network address of its /64 on upper peer, `link-local`: VM uses fe80::1 on upper peer
+	IPv6 string `json:"IPv6" validate:"omitempty,oneof=network link-local"`
+}
+
+// Announce - gratuitous ARP and unsolicited NA sent after VM start, so upstream ARP/ND caches point to this host node
+type Announce struct {
+	// rounds, every round announces each address once, defaults to 3, rounds after 5 seconds of intervals are skipped
+	Count int64 `json:"Count" validate:"omitempty,min=1,max=10"`
+	// milliseconds between rounds, defaults to 1000
+	Interval int64 `json:"Interval" validate:"omitempty,min=10,max=10000"`
+}
+
+// Route - IPv4 prefix routed behind VM, e.g. subnet of router or containers inside VM
+type Route struct {
+	// network address with prefix length, e.g. `195.177.118.120/29`
+	Prefix string `json:"Prefix" validate:"required,cidrv4"`
+	// next hop, one of VM `IPv4` addresses
+	Via string `json:"Via" validate:"required,ipv4"`
+}
+
+// Route6 - IPv6 prefix delegated to VM
+type Route6 struct {
+	// network address with prefix length, e.g. `2a02:2278:200::/56`
+	Prefix string `json:"Prefix" validate:"required,cidrv6"`
+	// next hop, VM address in `IPv6` or in `IPv6Prefix`
+	Via string `json:"Via" validate:"required,ipv6"`
+}
+
+// NIC - domain interface selector, by MAC or by alias, both must match when both are set
+type NIC struct {
+	// `<mac address='52:54:00:9a:01:01'/>`
+	MAC string `json:"MAC" validate:"required_without=Alias,omitempty,mac"`
+	// `<alias name='ua-wan'/>`
+	Alias string `json:"Alias" validate:"required_without=MAC"`
 }
 
 // Iface - represents interface name
@@ -57,38 +141,365 @@ type TC struct {
 	Limit int64 `json:"Limit" validate:"required,min=10240"`
 }
 
+// Naming - templates of interface names derived from domain UUID, used for omitted names
+//
+// Placeholders: `{uuid:N}` is first N hex digits of UUID, `{hash:N}` is first N base32 characters of UUID hash.
+type Naming struct {
+	// upper peer of Veth pair, defaults to `vu-{hash:12}`
+	Upper string `json:"Upper" validate:"omitempty,ifaceTemplate"`
+	// lower peer of Veth pair, defaults to `vl-{hash:12}`
+	Source string `json:"Source" validate:"omitempty,ifaceTemplate"`
+	// L3 tap created by libvirt, defaults to `if-{hash:12}`
+	Target string `json:"Target" validate:"omitempty,ifaceTemplate"`
+	// VxLAN tap created by libvirt, defaults to `vx-{hash:12}`
+	VxLAN string `json:"VxLAN" validate:"omitempty,ifaceTemplate"`
+}
+
+// HostSection - config for hosts selected by hostname or machine-id, all set selectors must match
+type HostSection struct {
+	// shell glob on hostname, e.g. `hv-fra-*`
+	Hostname string `json:"Hostname" validate:"required_without=MachineID,omitempty,glob"`
+	// content of `/etc/machine-id`
+	MachineID string `json:"MachineID" validate:"required_without=Hostname,omitempty,len=32,hexadecimal"`
+	// uplink of host, overrides `Defaults` and profiles
+	Uplink *Iface `json:"Uplink" validate:"omitempty"`
+	// local address of VxLAN tunnels, overrides `Defaults` and profiles
+	VxLANLocal string `json:"VxLANLocal" validate:"omitempty,ip"`
+	// traffic control of L3 and VxLAN taps, overrides `Defaults` and profiles
+	TC *TC `json:"TC" validate:"omitempty"`
+	// BGP settings of host, e.g. `RouterID`, override top-level `BGP` field by field
+	BGP *BGP `json:"BGP" validate:"-" schema:"partial"`
+	// VMs defined only on selected hosts
+	VMs map[string]VM `json:"VMs" schema:"partial"`
+}
+
+// BGP - BGP speaker announcing routes of running VMs to peers, e.g. top-of-rack routers
+type BGP struct {
+	// local AS number
+	ASN int64 `json:"ASN" validate:"required,min=1,max=4294967295"`
+	// BGP identifier of host node
+	RouterID string `json:"RouterID" validate:"required,ipv4"`
+	// seconds, defaults to 90
+	HoldTime int64 `json:"HoldTime" validate:"omitempty,min=3,max=65535"`
+	// next hop of IPv4 routes, defaults to local address of IPv4 session
+	NextHop4 string `json:"NextHop4" validate:"omitempty,ipv4"`
+	// next hop of IPv6 routes, defaults to local address of IPv6 session
+	NextHop6 string    `json:"NextHop6" validate:"omitempty,ipv6"`
+	Peers    []BGPPeer `json:"Peers" validate:"required,min=1,dive"`
+}
+
+// BGPPeer - BGP neighbor
+type BGPPeer struct {
+	Address string `json:"Address" validate:"required,ip"`
+	// remote AS number, same as local one for iBGP
+	ASN int64 `json:"ASN" validate:"required,min=1,max=4294967295"`
+	// TCP port, defaults to 179
+	Port int64 `json:"Port" validate:"omitempty,min=1,max=65535"`
+}
+
+// Timeouts - limits for external commands and hook invocation
+type Timeouts struct {
+	// seconds, per external command
+	Command int64 `json:"Command" validate:"omitempty,min=1"`
+	// seconds, per hook invocation
+	Hook int64 `json:"Hook" validate:"omitempty,min=1"`
+	// retries of transient command failures
+	Retries int64 `json:"Retries" validate:"omitempty,min=0,max=10"`
+	// milliseconds, delay before first retry, doubled after each retry
+	Backoff int64 `json:"Backoff" validate:"omitempty,min=1"`
+}
+
+// CommandDuration - per external command timeout
+func (t Timeouts) CommandDuration() time.Duration {
+	if t.Command == 0 {
+		return DefaultCommandTimeout
+	}
+
+	return time.Duration(t.Command) * time.Second
+}
+
+// HookDuration - per hook invocation timeout
+func (t Timeouts) HookDuration() time.Duration {
+	if t.Hook == 0 {
+		return DefaultHookTimeout
+	}
+
+	return time.Duration(t.Hook) * time.Second
+}
+
+// BackoffDuration - delay before first retry
+func (t Timeouts) BackoffDuration() time.Duration {
+	if t.Backoff == 0 {
+		return DefaultRetryBackoff
+	}
+
+	return time.Duration(t.Backoff) * time.Millisecond
+}
+
+// Routing - attributes of every route installed by hook, so routing daemons can tell VM routes from others
+type Routing struct {
+	// route protocol number, see `/etc/iproute2/rt_protos`, defaults to 220
+	Protocol int64 `json:"Protocol" validate:"omitempty,min=4,max=255"`
+	// routing table number, defaults to main table
+	Table int64 `json:"Table" validate:"omitempty,min=1,max=4294967295,ne=255"`
+	// route metric, kernel default when omitted
+	Metric int64 `json:"Metric" validate:"omitempty,min=1,max=4294967295"`
+	// route realm of IPv4 routes, IPv6 routes carry no realm, see `/etc/iproute2/rt_realms`
+	Realm int64 `json:"Realm" validate:"omitempty,min=1,max=255"`
+}
+
+// Log - logging configuration
+type Log struct {
+	// `file` (default), `syslog`, `journald` or `stderr`, unavailable sink falls back to stderr
+	Sink string `json:"Sink" validate:"omitempty,oneof=file syslog journald stderr"`
+	// unix socket of `syslog` or `journald` sink, defaults to `/dev/log` or `/run/systemd/journal/socket`
+	Address string `json:"Address" validate:"omitempty,filepath"`
+	// `text` or `json`
+	Format string `json:"Format" validate:"omitempty,oneof=text json"`
+	// `debug`, `info`, `warn` or `error`, commands are logged on `debug`
+	Level string `json:"Level" validate:"omitempty,oneof=debug info warn error"`
+}
+
 // Config - main hook config
 type Config struct {
-	VMs map[string]VM `json:"VMs" validate:"required"`
+	// partial VM config inherited by every VM
+	Defaults *VM `json:"Defaults" validate:"-" schema:"partial"`
+	// named partial VM configs, referenced by `VM.Profile`
+	Profiles map[string]VM `json:"Profiles" validate:"-" schema:"partial"`
+	// VMs may inherit from defaults and profile, effective config is validated on lookup
+	VMs map[string]VM `json:"VMs" validate:"required" schema:"partial"`
+	// per-host overrides and VMs, section matching current host is applied
+	Hosts []HostSection `json:"Hosts" validate:"omitempty,dive"`
+	// host section matching current host, nil when none matches
+	Host     *HostSection `json:"-"`
+	Naming   *Naming      `json:"Naming" validate:"omitempty"`
+	Timeouts *Timeouts    `json:"Timeouts" validate:"omitempty"`
+	Log      *Log         `json:"Log" validate:"omitempty"`
+	// attributes of routes installed by hook, defaults are used for missing values
+	Routing *Routing `json:"Routing" validate:"omitempty"`
+	// announcement of VM routes by `qemu bgp` daemon, disabled when omitted
+	BGP *BGP `json:"BGP" validate:"omitempty"`
 }
 
-// GetConfig - get application configuration
-func GetConfig(path string) (*Config, error) {
-	// prefix for errors logging
-	const errPrefix = "config error:"
+// GetTimeouts - configured timeouts, defaults are used for missing config
+func (c *Config) GetTimeouts() Timeouts {
+	if c == nil || c.Timeouts == nil {
+		return Timeouts{}
+	}
 
-	var err error
+	return *c.Timeouts
+}
+
+// GetRouting - configured route attributes, defaults are used for missing config
+func (c *Config) GetRouting() Routing {
+	if c == nil || c.Routing == nil {
+		return Routing{}
+	}
 
+	return *c.Routing
+}
+
+// DropInDir - directory with per-VM drop-in config files: `/etc/libvirt/hooks/qemu-hook.yaml` uses `/etc/libvirt/hooks/qemu-hook.d`
+func DropInDir(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".d"
+}
+
+// DropInFiles - lists drop-in config files of supported formats in lexical order
+//
+// Hidden files are skipped, so tooling can write `.vm1.json.tmp` and rename it to `vm1.json`
+// and hook never observes partially written file.
+func DropInFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || !IsConfigFile(entry.Name()) {
+			continue
+		}
+
+		files = append(files, filepath.Join(dir, entry.Name()))
+	}
+
+	sort.Strings(files)
+
+	return files, nil
+}
+
+// readConfigFile - decodes single config file, each VM remembers its source file
+func readConfigFile(path string) (*Config, error) {
 	// create config object
-	c = new(Config)
+	c := new(Config)
 
 	// read config file
 	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// convert config file to object, format is detected from file extension
+	err = DecodeConfig(path, data, c)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, vm := range c.VMs {
+		vm.Source = path
+		c.VMs[name] = vm
+	}
+
+	for _, h := range c.Hosts {
+		for name, vm := range h.VMs {
+			vm.Source = path
+			h.VMs[name] = vm
+		}
+	}
+
+	return c, nil
+}
+
+// LocateValidation - adds positions in source files to validation errors, each failed field is located separately,
+// prefix is key path of validated struct, e.g. `VMs.vm1` for VM validated alone, empty for whole config
+func (c *Config) LocateValidation(path, prefix string, err error) error {
+	var fieldErrs validator.ValidationErrors
+	if !errors.As(err, &fieldErrs) {
+		return err
+	}
+
+	errs := make([]error, 0, len(fieldErrs))
+
+	for _, fe := range fieldErrs {
+		field := NamespaceField(fe.Namespace())
+		if prefix != "" {
+			field = prefix + "." + field
+		}
+
+		errs = append(errs, c.locate(path, &FieldError{Field: field, Err: validator.ValidationErrors{fe}}))
+	}
+
+	return errors.Join(errs...)
+}
+
+// locate - adds position in source file to error of field, fields of VM are located in file VM is defined in,
+// file without position of field or its ancestors is named alone
+func (c *Config) locate(path string, err error) error {
+	var fieldErr *FieldError
+	if !errors.As(err, &fieldErr) {
+		return err
+	}
+
+	file := path
+
+	for name, vm := range c.VMs {
+		prefix := "VMs." + name
+		if vm.Source != "" && (fieldErr.Field == prefix || strings.HasPrefix(fieldErr.Field, prefix+".")) {
+			file = vm.Source
+
+			break
+		}
+	}
+
+	data, readErr := os.ReadFile(file)
+	if readErr == nil {
+		pos, ok := PositionOf(ConfigPositions(file, data), fieldErr.Field)
+		if ok {
+			return &PositionError{Path: file, Line: pos.Line, Column: pos.Column, Message: err.Error()}
+		}
+	}
+
+	return fmt.Errorf("%s: %s", file, err)
+}
+
+// GetConfig - get application configuration for current host node, main config file is merged with drop-in files
+func GetConfig(path string) (*Config, error) {
+	id, err := CurrentHost()
+	if err != nil {
+		return nil, fmt.Errorf("config error: %s", err)
+	}
+
+	return GetHostConfig(path, id)
+}
+
+// GetHostConfig - get application configuration for host node, main config file is merged with drop-in files
+func GetHostConfig(path string, id HostIdentity) (*Config, error) {
+	// prefix for errors logging
+	const errPrefix = "config error:"
+
+	c, err := readConfigFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("%s %s", errPrefix, err)
 	}
 
-	// convert config file to object
-	err = json.Unmarshal(data, c)
+	if c.VMs == nil {
+		c.VMs = make(map[string]VM)
+	}
+
+	// drop-in files, missing directory is same as empty one
+	files, err := DropInFiles(DropInDir(path))
 	if err != nil {
 		return nil, fmt.Errorf("%s %s", errPrefix, err)
 	}
 
-	// additional structe validation
-	err = Validate.Struct(c)
+	for _, file := range files {
+		dropIn, err := readConfigFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s", errPrefix, err)
+		}
+
+		// drop-in files only define VMs
+		if dropIn.Timeouts != nil || dropIn.Log != nil || dropIn.Defaults != nil || dropIn.Profiles != nil || dropIn.Hosts != nil || dropIn.Routing != nil || dropIn.BGP != nil {
+			return nil, fmt.Errorf("%s %s: only VMs may be defined in drop-in file", errPrefix, file)
+		}
+
+		for name, vm := range dropIn.VMs {
+			dup, ok := c.VMs[name]
+			if ok {
+				return nil, fmt.Errorf("%s duplicate VM '%s' defined in '%s' and '%s'", errPrefix, name, dup.Source, vm.Source)
+			}
+
+			c.VMs[name] = vm
+		}
+	}
+
+	// host section overrides defaults and adds VMs of host node
+	err = c.SelectHost(id)
 	if err != nil {
 		return nil, fmt.Errorf("%s %s", errPrefix, err)
 	}
 
+	// no VMs at all is same as missing VMs
+	if len(c.VMs) == 0 {
+		c.VMs = nil
+	}
+
+	// VMs inherit defaults and profiles, effective config is validated
+	err = c.ResolveVMs()
+	if err != nil {
+		return nil, fmt.Errorf("%s %s", errPrefix, c.locate(path, err))
+	}
+
+	// naming templates and interface names of VMs, checked before struct validation for detailed errors
+	err = c.Naming.Check(c.VMs)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s", errPrefix, c.locate(path, err))
+	}
+
+	// additional structe validation, VMs are validated on lookup
+	err = Validate.Struct(c)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s", errPrefix, c.LocateValidation(path, "", err))
+	}
+
+	// IPv6 address space is routed to single VM
+	err = c.CheckIPv6Prefixes()
+	if err != nil {
+		return nil, fmt.Errorf("%s %s", errPrefix, c.locate(path, err))
+	}
+
 	return c, nil
 }
@@ -0,0 +1,452 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+)
+
+// ConfigExtensions - supported config file extensions
+var ConfigExtensions = []string{".json", ".yaml", ".yml", ".toml"}
+
+// IsConfigFile - reports whether file extension is one of supported config formats
+func IsConfigFile(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+
+	for _, e := range ConfigExtensions {
+		if ext == e {
+			return true
+		}
+	}
+
+	return false
+}
+
+// PositionError - config decoding error with position in source file
+type PositionError struct {
+	Path    string
+	Line    int
+	Column  int
+	Message string
+}
+
+// Error - `path:line:column: message`
+func (e *PositionError) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s", e.Path, e.Line, e.Column, e.Message)
+}
+
+// FieldError - config error of field found after decoding, located in source file by `PositionOf`
+type FieldError struct {
+	// path of keys in config file, e.g. `VMs.vm1.Interface.VxLAN.VNI`, slice elements are keyed by index
+	Field string
+	Err   error
+}
+
+// Error - message of wrapped error, position is added when field is located
+func (e *FieldError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap - wrapped error
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// fieldNamespace - `[key]` of map or slice element in validator namespace
+var fieldNamespace = regexp.MustCompile(`\[([^\]]*)\]`)
+
+// NamespaceField - key path of validator namespace, e.g. `Config.VMs[vm1].Interface.VxLAN.VNI` is `VMs.vm1.Interface.VxLAN.VNI`,
+// config field names are same as their json tags
+func NamespaceField(namespace string) string {
+	_, field, _ := strings.Cut(fieldNamespace.ReplaceAllString(namespace, ".$1"), ".")
+
+	return field
+}
+
+// filePosition - 1-based line and column of key in config file
+type filePosition struct {
+	Line   int
+	Column int
+}
+
+// ConfigPositions - positions of keys in config data keyed by key path, format is detected from file extension
+//
+// Positions are best effort: data that fails to decode, TOML multi-line values and fields of TOML inline tables have no position.
+func ConfigPositions(path string, data []byte) map[string]filePosition {
+	out := make(map[string]filePosition)
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		yamlPositions(data, out)
+	case ".toml":
+		tomlPositions(data, out)
+	case ".json":
+		jsonPositions(data, out)
+	}
+
+	return out
+}
+
+// PositionOf - position of field or of its closest ancestor, field may be nested in host section, e.g. `Hosts.0.VMs.vm1`
+func PositionOf(positions map[string]filePosition, field string) (filePosition, bool) {
+	for field != "" {
+		if pos, ok := positions[field]; ok {
+			return pos, true
+		}
+
+		// first match in file wins
+		var found *filePosition
+
+		for key, pos := range positions {
+			if strings.HasSuffix(key, "."+field) && (found == nil || pos.Line < found.Line) {
+				found = &pos
+			}
+		}
+
+		if found != nil {
+			return *found, true
+		}
+
+		i := strings.LastIndex(field, ".")
+		if i < 0 {
+			break
+		}
+
+		field = field[:i]
+	}
+
+	return filePosition{}, false
+}
+
+// childPath - path with one more key, never shares memory with path
+func childPath(path []string, key string) []string {
+	return append(path[:len(path):len(path)], key)
+}
+
+// jsonPositions - positions of JSON object keys and array elements
+func jsonPositions(data []byte, out map[string]filePosition) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+
+	// offset of next value, after whitespace and separators following last token
+	next := func() int64 {
+		offset := dec.InputOffset()
+		for offset < int64(len(data)) && strings.IndexByte(" \t\r\n,:", data[offset]) >= 0 {
+			offset++
+		}
+
+		return offset
+	}
+
+	var walk func(path []string) error
+
+	walk = func(path []string) error {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+
+		switch tok {
+		case json.Delim('{'):
+			for dec.More() {
+				start := next()
+
+				tok, err = dec.Token()
+				if err != nil {
+					return err
+				}
+
+				key, _ := tok.(string)
+				p := childPath(path, key)
+
+				line, column := lineColumn(data, start)
+				out[strings.Join(p, ".")] = filePosition{line, column}
+
+				err = walk(p)
+				if err != nil {
+					return err
+				}
+			}
+
+			_, err = dec.Token()
+		case json.Delim('['):
+			for i := 0; dec.More(); i++ {
+				p := childPath(path, strconv.Itoa(i))
+
+				line, column := lineColumn(data, next())
+				out[strings.Join(p, ".")] = filePosition{line, column}
+
+				err = walk(p)
+				if err != nil {
+					return err
+				}
+			}
+
+			_, err = dec.Token()
+		}
+
+		return err
+	}
+
+	_ = walk(nil)
+}
+
+// yamlPositions - positions of YAML mapping keys and sequence entries
+func yamlPositions(data []byte, out map[string]filePosition) {
+	file, err := parser.ParseBytes(data, 0)
+	if err != nil {
+		return
+	}
+
+	record := func(path []string, node ast.Node) {
+		// block mapping is located at its first key, not at `:` delimiter
+		switch n := node.(type) {
+		case *ast.MappingNode:
+			if !n.IsFlowStyle && len(n.Values) != 0 {
+				node = n.Values[0].Key
+			}
+		case *ast.MappingValueNode:
+			node = n.Key
+		}
+
+		if tk := node.GetToken(); tk != nil && tk.Position != nil {
+			out[strings.Join(path, ".")] = filePosition{tk.Position.Line, tk.Position.Column}
+		}
+	}
+
+	var walk func(path []string, node ast.Node)
+
+	walk = func(path []string, node ast.Node) {
+		switch n := node.(type) {
+		case *ast.DocumentNode:
+			walk(path, n.Body)
+		case *ast.AnchorNode:
+			walk(path, n.Value)
+		case *ast.TagNode:
+			walk(path, n.Value)
+		case *ast.MappingNode:
+			for _, v := range n.Values {
+				walk(path, v)
+			}
+		case *ast.MappingValueNode:
+			tk := n.Key.GetToken()
+			if tk == nil {
+				return
+			}
+
+			p := childPath(path, tk.Value)
+			record(p, n.Key)
+			walk(p, n.Value)
+		case *ast.SequenceNode:
+			for i, v := range n.Values {
+				p := childPath(path, strconv.Itoa(i))
+				record(p, v)
+				walk(p, v)
+			}
+		}
+	}
+
+	for _, doc := range file.Docs {
+		walk(nil, doc)
+	}
+}
+
+// tomlKey - parts of dotted TOML key, quoted parts are unquoted
+func tomlKey(s string) []string {
+	var (
+		parts []string
+		part  strings.Builder
+		quote rune
+	)
+
+	for _, r := range strings.TrimSpace(s) {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			part.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '.':
+			parts = append(parts, strings.TrimSpace(part.String()))
+			part.Reset()
+		default:
+			part.WriteRune(r)
+		}
+	}
+
+	return append(parts, strings.TrimSpace(part.String()))
+}
+
+// tomlPositions - positions of TOML table headers and keys, elements of arrays of tables are keyed by index
+func tomlPositions(data []byte, out map[string]filePosition) {
+	var table []string
+
+	// elements of each array of tables so far
+	counts := make(map[string]int)
+
+	// header path with indexes of arrays of tables it is nested in
+	resolve := func(key []string) []string {
+		var p []string
+
+		for i, k := range key {
+			p = append(p, k)
+
+			if n := counts[strings.Join(p, ".")]; n != 0 && i != len(key)-1 {
+				p = append(p, strconv.Itoa(n-1))
+			}
+		}
+
+		return p
+	}
+
+	for i, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimSpace(line)
+		pos := filePosition{Line: i + 1, Column: len(line) - len(strings.TrimLeft(line, " \t")) + 1}
+
+		switch {
+		case trimmed == "" || strings.HasPrefix(trimmed, "#"):
+		case strings.HasPrefix(trimmed, "[["):
+			header, _, _ := strings.Cut(trimmed[2:], "]]")
+			p := resolve(tomlKey(header))
+
+			name := strings.Join(p, ".")
+			if _, ok := out[name]; !ok {
+				out[name] = pos
+			}
+
+			table = childPath(p, strconv.Itoa(counts[name]))
+			counts[name]++
+
+			out[strings.Join(table, ".")] = pos
+		case strings.HasPrefix(trimmed, "["):
+			header, _, _ := strings.Cut(trimmed[1:], "]")
+			table = resolve(tomlKey(header))
+
+			out[strings.Join(table, ".")] = pos
+		default:
+			key, _, ok := strings.Cut(trimmed, "=")
+			if !ok {
+				continue
+			}
+
+			p := append(table[:len(table):len(table)], tomlKey(key)...)
+			out[strings.Join(p, ".")] = pos
+		}
+	}
+}
+
+// DecodeConfig - decodes config data, format is detected from file extension
+func DecodeConfig(path string, data []byte, v any) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return decodeYAML(path, data, v)
+	case ".toml":
+		return decodeTOML(path, data, v)
+	case ".json":
+		return decodeJSON(path, data, v)
+	default:
+		return fmt.Errorf("%s: unsupported config format, expected one of %s", path, strings.Join(ConfigExtensions, ", "))
+	}
+}
+
+// lineColumn - converts byte offset to 1-based line and column
+func lineColumn(data []byte, offset int64) (int, int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := int(offset) - (bytes.LastIndexByte(before, '\n') + 1) + 1
+
+	return line, column
+}
+
+// decodeJSON - decodes JSON, syntax and type errors carry position
+func decodeJSON(path string, data []byte, v any) error {
+	err := json.Unmarshal(data, v)
+	if err == nil {
+		return nil
+	}
+
+	var (
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+	)
+
+	switch {
+	case errors.As(err, &syntaxErr):
+		// offset is counted after offending byte
+		line, column := lineColumn(data, max(syntaxErr.Offset-1, 0))
+
+		return &PositionError{Path: path, Line: line, Column: column, Message: syntaxErr.Error()}
+	case errors.As(err, &typeErr):
+		line, column := lineColumn(data, typeErr.Offset)
+
+		return &PositionError{Path: path, Line: line, Column: column, Message: typeErr.Error()}
+	}
+
+	return fmt.Errorf("%s: %s", path, err)
+}
+
+// decodeYAML - decodes YAML, field names are taken from json tags
+func decodeYAML(path string, data []byte, v any) error {
+	err := yaml.Unmarshal(data, v)
+	if err == nil {
+		return nil
+	}
+
+	var yamlErr yaml.Error
+	if errors.As(err, &yamlErr) && yamlErr.GetToken() != nil && yamlErr.GetToken().Position != nil {
+		pos := yamlErr.GetToken().Position
+
+		return &PositionError{Path: path, Line: pos.Line, Column: pos.Column, Message: yamlErr.GetMessage()}
+	}
+
+	return fmt.Errorf("%s: %s", path, err)
+}
+
+// tomlLastKey - extracts line and last key from TOML decoding errors, which are reported without column
+var tomlLastKey = regexp.MustCompile(`^toml: line (\d+) \(last key "([^"]*)"\): (.*)$`)
+
+// decodeTOML - decodes TOML, field names are matched to Go field names, same as json tags
+func decodeTOML(path string, data []byte, v any) error {
+	_, err := toml.Decode(string(data), v)
+	if err == nil {
+		return nil
+	}
+
+	var parseErr toml.ParseError
+	if errors.As(err, &parseErr) {
+		return &PositionError{Path: path, Line: parseErr.Position.Line, Column: parseErr.Position.Col, Message: parseErr.Message}
+	}
+
+	// type errors carry line and key, column is where key starts on that line
+	m := tomlLastKey.FindStringSubmatch(err.Error())
+	if m != nil {
+		line, _ := strconv.Atoi(m[1])
+		column := 1
+
+		lines := strings.Split(string(data), "\n")
+		if line >= 1 && line <= len(lines) {
+			key := m[2][strings.LastIndex(m[2], ".")+1:]
+			if i := strings.Index(lines[line-1], key); i >= 0 {
+				column = i + 1
+			}
+		}
+
+		return &PositionError{Path: path, Line: line, Column: column, Message: m[3]}
+	}
+
+	return fmt.Errorf("%s: %s", path, err)
+}
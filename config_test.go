@@ -0,0 +1,396 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeConfigFiles - writes files relative to directory
+func writeConfigFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = os.WriteFile(path, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// testVMConfig - minimal valid VM config in JSON
+const testVMConfig = `{"Interface": {"L3": {"IPv4": ["195.177.118.111"], "TC": {"Rate": 250, "Burst": 256, "Limit": 10240},
+	"Upper": {"Name": "vu-9a0101"}, "Source": {"Name": "vl-9a0101"}, "Target": {"Name": "if-9a0101"}}, "Uplink": {"Name": "bond-wan"}}}`
+
+// testVMConfigN - testVMConfig with interface names of n-th VM, VMs must not share interface names
+func testVMConfigN(n int) string {
+	return strings.ReplaceAll(testVMConfig, "9a0101", fmt.Sprintf("9a01%02d", n))
+}
+
+func TestGetConfigDropIns(t *testing.T) {
+	cases := []struct {
+		caseDescription string
+		files           map[string]string
+		sources         map[string]string // VM name to source file
+		err             string
+	}{
+		{
+			caseDescription: "main config only",
+			files: map[string]string{
+				"qemu-hook.json": `{"VMs": {"vm1": ` + testVMConfig + `}}`,
+			},
+			sources: map[string]string{"vm1": "qemu-hook.json"},
+		},
+		{
+			caseDescription: "drop-ins merged, hidden and non-config files skipped",
+			files: map[string]string{
+				"qemu-hook.json":                 `{"VMs": {"vm1": ` + testVMConfig + `}}`,
+				"qemu-hook.d/vm2.json":           `{"VMs": {"vm2": ` + testVMConfigN(2) + `}}`,
+				"qemu-hook.d/group.json":         `{"VMs": {"vm3": ` + testVMConfigN(3) + `, "vm4": ` + testVMConfigN(4) + `}}`,
+				"qemu-hook.d/.vm5.json.tmp":      `{"VMs": {"vm5": `,
+				"qemu-hook.d/.vm6.json":          `{"VMs": {"vm6": `,
+				"qemu-hook.d/vm7.json.dpkg-dist": `{"VMs": {"vm7": `,
+				"qemu-hook.d/vm8.yaml":           "VMs:\n  vm8: " + testVMConfigN(8) + "\n",
+			},
+			sources: map[string]string{
+				"vm1": "qemu-hook.json",
+				"vm2": "qemu-hook.d/vm2.json",
+				"vm3": "qemu-hook.d/group.json",
+				"vm4": "qemu-hook.d/group.json",
+				"vm8": "qemu-hook.d/vm8.yaml",
+			},
+		},
+		{
+			caseDescription: "VMs from drop-ins only",
+			files: map[string]string{
+				"qemu-hook.json":       `{}`,
+				"qemu-hook.d/vm1.json": `{"VMs": {"vm1": ` + testVMConfig + `}}`,
+			},
+			sources: map[string]string{"vm1": "qemu-hook.d/vm1.json"},
+		},
+		{
+			caseDescription: "no VMs at all",
+			files: map[string]string{
+				"qemu-hook.json": `{}`,
+			},
+			err: "'VMs' failed on the 'required' tag",
+		},
+		{
+			caseDescription: "duplicate VM",
+			files: map[string]string{
+				"qemu-hook.json":       `{"VMs": {"vm1": ` + testVMConfig + `}}`,
+				"qemu-hook.d/vm1.json": `{"VMs": {"vm1": ` + testVMConfig + `}}`,
+			},
+			err: "duplicate VM 'vm1' defined in",
+		},
+		{
+			caseDescription: "broken drop-in reports its file",
+			files: map[string]string{
+				"qemu-hook.json":       `{"VMs": {"vm1": ` + testVMConfig + `}}`,
+				"qemu-hook.d/vm2.json": `{"VMs": {"vm2": `,
+			},
+			err: "qemu-hook.d/vm2.json",
+		},
+		{
+			caseDescription: "drop-in with defaults",
+			files: map[string]string{
+				"qemu-hook.json":            `{"VMs": {"vm1": ` + testVMConfig + `}}`,
+				"qemu-hook.d/defaults.json": `{"Defaults": {"Interface": {"Uplink": {"Name": "bond-lan"}}}}`,
+			},
+			err: "only VMs may be defined in drop-in file",
+		},
+		{
+			caseDescription: "drop-in VM references profile of main config",
+			files: map[string]string{
+				"qemu-hook.json":       `{"Profiles": {"p1": ` + testVMConfigN(2) + `}, "VMs": {"vm1": ` + testVMConfig + `}}`,
+				"qemu-hook.d/vm2.json": `{"VMs": {"vm2": {"Profile": "p1"}}}`,
+			},
+			sources: map[string]string{"vm1": "qemu-hook.json", "vm2": "qemu-hook.d/vm2.json"},
+		},
+		{
+			caseDescription: "unknown profile reports VM and its file",
+			files: map[string]string{
+				"qemu-hook.json":       `{"VMs": {"vm1": ` + testVMConfig + `}}`,
+				"qemu-hook.d/vm2.json": `{"VMs": {"vm2": {"Profile": "p1"}}}`,
+			},
+			err: "qemu-hook.d/vm2.json:1:10: VM 'vm2': unknown profile 'p1'",
+		},
+		{
+			caseDescription: "drop-in with global section",
+			files: map[string]string{
+				"qemu-hook.json":       `{"VMs": {"vm1": ` + testVMConfig + `}}`,
+				"qemu-hook.d/log.json": `{"Log": {"Format": "json"}}`,
+			},
+			err: "only VMs may be defined in drop-in file",
+		},
+	}
+
+	for _, testCase := range cases {
+		dir := t.TempDir()
+		writeConfigFiles(t, dir, testCase.files)
+
+		cfg, err := GetHostConfig(filepath.Join(dir, "qemu-hook.json"), testHost)
+		if testCase.err != "" {
+			if err == nil || !strings.Contains(err.Error(), testCase.err) {
+				t.Errorf("TestCase: %s\n Got : %v\n Want: %s\n", testCase.caseDescription, err, testCase.err)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("TestCase: %s\n Got : %s\n Want: nil", testCase.caseDescription, err)
+		}
+
+		if len(cfg.VMs) != len(testCase.sources) {
+			t.Errorf("TestCase: %s\n Got : %d VMs\n Want: %d VMs\n", testCase.caseDescription, len(cfg.VMs), len(testCase.sources))
+		}
+
+		for name, source := range testCase.sources {
+			if cfg.VMs[name].Source != filepath.Join(dir, source) {
+				t.Errorf("TestCase: %s\n Got : %s\n Want: %s\n", testCase.caseDescription, cfg.VMs[name].Source, filepath.Join(dir, source))
+			}
+		}
+	}
+}
+
+func TestSampleConfig(t *testing.T) {
+	cfg, err := GetHostConfig("qemu-hook.json", testHost)
+	if err != nil {
+		t.Fatalf("TestCase: shipped sample config\n Got : %s\n Want: nil", err)
+	}
+
+	if len(cfg.VMs) == 0 {
+		t.Errorf("TestCase: shipped sample config\n Got : no VMs\n Want: at least one VM")
+	}
+}
+
+func TestGetConfigFormats(t *testing.T) {
+	want, err := GetHostConfig("testdata/qemu-hook.json", testHost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"testdata/qemu-hook.yaml", "testdata/qemu-hook.toml"} {
+		got, err := GetHostConfig(path, testHost)
+		if err != nil {
+			t.Errorf("TestCase: %s\n Got : %s\n Want: nil", path, err)
+
+			continue
+		}
+
+		// sources differ by design
+		for name, vm := range got.VMs {
+			vm.Source = want.VMs[name].Source
+			got.VMs[name] = vm
+		}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("TestCase: %s\n Got : %+v\n Want: %+v\n", path, got, want)
+		}
+	}
+}
+
+func TestDecodeConfigPositions(t *testing.T) {
+	cases := []struct {
+		caseDescription string
+		path            string
+		content         string
+		err             string
+	}{
+		{
+			caseDescription: "json syntax error",
+			path:            "qemu-hook.json",
+			content:         "{\n  \"VMs\": {\n    \"vm1\": ,\n  }\n}\n",
+			err:             "qemu-hook.json:3:12: ",
+		},
+		{
+			caseDescription: "json type error",
+			path:            "qemu-hook.json",
+			content:         "{\n  \"Timeouts\": {\n    \"Retries\": \"three\"\n  }\n}\n",
+			err:             "qemu-hook.json:3:",
+		},
+		{
+			caseDescription: "yaml syntax error",
+			path:            "qemu-hook.yaml",
+			content:         "VMs:\n  vm1:\n    Interface: [\n",
+			err:             "qemu-hook.yaml:3:",
+		},
+		{
+			caseDescription: "yaml type error",
+			path:            "qemu-hook.yml",
+			content:         "Timeouts:\n  Retries: three\n",
+			err:             "qemu-hook.yml:2:12: ",
+		},
+		{
+			caseDescription: "toml syntax error",
+			path:            "qemu-hook.toml",
+			content:         "[Timeouts]\nRetries = = 3\n",
+			err:             "qemu-hook.toml:2:",
+		},
+		{
+			caseDescription: "toml type error",
+			path:            "qemu-hook.toml",
+			content:         "[Timeouts]\nRetries = \"three\"\n",
+			err:             "qemu-hook.toml:2:1: ",
+		},
+		{
+			caseDescription: "unsupported format",
+			path:            "qemu-hook.ini",
+			content:         "",
+			err:             "unsupported config format",
+		},
+	}
+
+	for _, testCase := range cases {
+		var cfg Config
+
+		err := DecodeConfig(testCase.path, []byte(testCase.content), &cfg)
+		if err == nil || !strings.Contains(err.Error(), testCase.err) {
+			t.Errorf("TestCase: %s\n Got : %v\n Want: %s\n", testCase.caseDescription, err, testCase.err)
+		}
+	}
+}
+
+func TestGetConfigValidationPositions(t *testing.T) {
+	cases := []struct {
+		caseDescription string
+		path            string
+		content         string
+		err             string
+	}{
+		{
+			caseDescription: "json validation error",
+			path:            "qemu-hook.json",
+			content: `{
+  "VMs": {
+    "vm1": {"Interface": {
+      "Uplink": {"Name": "bond-wan"},
+      "L3": {
+        "IPv4": ["195.177.118.999"],
+        "TC": {"Rate": 250, "Burst": 256, "Limit": 10240},
+        "Upper": {"Name": "vu-9a0101"}, "Source": {"Name": "vl-9a0101"}, "Target": {"Name": "if-9a0101"}
+      }
+    }}
+  }
+}
+`,
+			err: "qemu-hook.json:6:18: Key: 'VM.Interface.L3.IPv4[0]' Error:Field validation for 'IPv4[0]' failed on the 'ipv4' tag",
+		},
+		{
+			caseDescription: "yaml validation error",
+			path:            "qemu-hook.yaml",
+			content: `VMs:
+  vm1:
+    Interface:
+      Uplink:
+        Name: bond-wan
+      L3:
+        IPv4:
+          - 195.177.118.999
+        TC: {Rate: 250, Burst: 256, Limit: 10240}
+        Upper: {Name: vu-9a0101}
+        Source: {Name: vl-9a0101}
+        Target: {Name: if-9a0101}
+`,
+			err: "qemu-hook.yaml:8:13: Key: 'VM.Interface.L3.IPv4[0]' Error:Field validation for 'IPv4[0]' failed on the 'ipv4' tag",
+		},
+		{
+			caseDescription: "toml validation error",
+			path:            "qemu-hook.toml",
+			content: `[VMs.vm1.Interface.Uplink]
+Name = "bond-wan"
+
+[VMs.vm1.Interface.L3]
+IPv4 = ["195.177.118.111"]
+Upper = { Name = "vu-9a0101" }
+Source = { Name = "vl-9a0101" }
+Target = { Name = "if-9a0101" }
+
+[VMs.vm1.Interface.L3.TC]
+Rate = 250
+Burst = 256
+Limit = 0
+`,
+			err: "qemu-hook.toml:13:1: Key: 'VM.Interface.L3.TC.Limit' Error:Field validation for 'Limit' failed on the 'required' tag",
+		},
+		{
+			caseDescription: "toml field of inline table is located at table",
+			path:            "qemu-hook.toml",
+			content: `[VMs.vm1.Interface.Uplink]
+Name = "bond-wan"
+
+[VMs.vm1.Interface.L3]
+IPv4 = ["195.177.118.111"]
+  Upper = { Name = "vu_9a0101" }
+Source = { Name = "vl-9a0101" }
+Target = { Name = "if-9a0101" }
+TC = { Rate = 250, Burst = 256, Limit = 10240 }
+`,
+			err: "qemu-hook.toml:6:3: Key: 'VM.Interface.L3.Upper.Name'",
+		},
+		{
+			caseDescription: "json validation error of config",
+			path:            "qemu-hook.json",
+			content:         "{\n  \"Timeouts\": {\n    \"Retries\": 11\n  },\n  \"VMs\": {\"vm1\": " + testVMConfig + "}\n}\n",
+			err:             "qemu-hook.json:3:5: Key: 'Config.Timeouts.Retries' Error:Field validation for 'Retries' failed on the 'max' tag",
+		},
+		{
+			caseDescription: "yaml validation error of host section",
+			path:            "qemu-hook.yaml",
+			content:         "Hosts:\n  - Hostname: hv2\n  - Uplink: {Name: eth0}\nVMs:\n  vm1: " + testVMConfig + "\n",
+			err:             "qemu-hook.yaml:3:5: Key: 'Config.Hosts[1].Hostname' Error:Field validation for 'Hostname' failed on the 'required_without' tag",
+		},
+		{
+			caseDescription: "toml validation error of config",
+			path:            "qemu-hook.toml",
+			content:         "[Routing]\nProtocol = 201\n  Table = 255\n",
+			err:             "qemu-hook.toml:3:3: Key: 'Config.Routing.Table' Error:Field validation for 'Table' failed on the 'ne' tag",
+		},
+		{
+			caseDescription: "json validation error of VM in host section",
+			path:            "qemu-hook.json",
+			content:         "{\"Hosts\": [{\"Hostname\": \"hv1\",\n  \"VMs\": {\"vm1\": " + strings.Replace(testVMConfig, "195.177.118.111", "195.177.118.999", 1) + "}}]}\n",
+			err:             "qemu-hook.json:2:49: Key: 'VM.Interface.L3.IPv4[0]'",
+		},
+		{
+			caseDescription: "yaml error of other check",
+			path:            "qemu-hook.yml",
+			content: `Naming:
+  Upper: "vu-{hash:12}"
+  Source: "vu{hash:12}"
+`,
+			err: "qemu-hook.yml:3:3: naming templates of Upper 'vu-{hash:12}' and Source 'vu{hash:12}' may render same name",
+		},
+	}
+
+	for _, testCase := range cases {
+		dir := t.TempDir()
+		path := filepath.Join(dir, testCase.path)
+
+		err := os.WriteFile(path, []byte(testCase.content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// VMs are validated on lookup, same as hook does
+		cfg, err := GetHostConfig(path, testHost)
+		if err == nil {
+			err = cfg.LocateValidation(path, "VMs.vm1", Validate.Struct(cfg.VMs["vm1"]))
+		}
+
+		if err == nil || !strings.Contains(err.Error(), filepath.Join(dir, testCase.err)) {
+			t.Errorf("TestCase: %s\n Got : %v\n Want: %s\n", testCase.caseDescription, err, testCase.err)
+		}
+	}
+}
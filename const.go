@@ -1,7 +1,41 @@
 package main
 
+import (
+	"time"
+)
+
 // LogFilePath - path to log file
 const LogFilePath = "/var/log/libvirt/qemu/qemu-hook.log"
 
 // ConfigPath - path to hook config
 const ConfigPath = "/etc/libvirt/hooks/qemu-hook.json"
+
+// HookMarker - prefix of interface alias (ifalias) set on every link created by hook
+const HookMarker = "qemu-hook"
+
+// HookMetadataNamespace - XML namespace of hook elements in domain `<metadata>`
+const HookMetadataNamespace = "https://github.com/s3rj1k/go-libvirt-custom-hook"
+
+// HookRouteProtocol - default route protocol number set on every route installed by hook, see `/etc/iproute2/rt_protos`
+const HookRouteProtocol = "220"
+
+// HookQdiscHandle - root qdisc handle major number set on every qdisc configured by hook
+const HookQdiscHandle = "4843"
+
+// LibvirtQemuRunDir - libvirt runtime directory with status XML of running domains
+const LibvirtQemuRunDir = "/run/libvirt/qemu"
+
+// HookRunDir - hook runtime directory, for locks and state
+const HookRunDir = "/run/qemu-hook"
+
+// LockTimeout - max time to wait for lock held by concurrent hook invocation
+const LockTimeout = 60 * time.Second
+
+// DefaultCommandTimeout - default max run time of single external command
+const DefaultCommandTimeout = 30 * time.Second
+
+// DefaultHookTimeout - default max run time of whole hook invocation
+const DefaultHookTimeout = 5 * time.Minute
+
+// DefaultRetryBackoff - default delay before first retry of transient command failure, doubled after each retry
+const DefaultRetryBackoff = 200 * time.Millisecond
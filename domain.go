@@ -2,8 +2,11 @@ package main
 
 import (
 	"bufio"
+	"encoding/xml"
 	"fmt"
 	"io"
+	"os"
+	"path/filepath"
 	"strings"
 
 	libvirtxml "github.com/libvirt/libvirt-go-xml"
@@ -27,7 +30,7 @@ func GetDomainXML(stdin io.Reader) (*libvirtxml.Domain, error) {
 	err := scanner.Err()
 	if err != nil {
 		e := fmt.Errorf("domain XML error: %s", err.Error())
-		Logger.Println(e)
+		Logger.Error(e.Error())
 
 		return nil, e
 	}
@@ -39,10 +42,48 @@ func GetDomainXML(stdin io.Reader) (*libvirtxml.Domain, error) {
 	err = domCfg.Unmarshal(strings.Join(lines, ""))
 	if err != nil {
 		e := fmt.Errorf("domain XML error: %s", err.Error())
-		Logger.Println(e)
+		Logger.Error(e.Error())
 
 		return nil, e
 	}
 
 	return domCfg, nil
 }
+
+// domainStatus - libvirt status XML of running domain, wraps domain XML
+type domainStatus struct {
+	Domain libvirtxml.Domain `xml:"domain"`
+}
+
+// GetRunningDomains - acquires Libvirt Domain XML of running domains from libvirt runtime directory
+func GetRunningDomains(dir string) ([]*libvirtxml.Domain, error) {
+	// prefix for errors logging
+	const errPrefix = "running domains error:"
+
+	// list status XML files, one per running domain
+	paths, err := filepath.Glob(filepath.Join(filepath.Clean(dir), "*.xml"))
+	if err != nil {
+		return nil, fmt.Errorf("%s %s", errPrefix, err)
+	}
+
+	domains := make([]*libvirtxml.Domain, 0, len(paths))
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s", errPrefix, err)
+		}
+
+		// decode status XML
+		status := new(domainStatus)
+
+		err = xml.Unmarshal(data, status)
+		if err != nil {
+			return nil, fmt.Errorf("%s '%s': %s", errPrefix, path, err)
+		}
+
+		domains = append(domains, &status.Domain)
+	}
+
+	return domains, nil
+}
@@ -1,11 +1,27 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os/exec"
 	"strings"
 	"syscall"
+	"time"
 )
 
+// ErrCommandTimeout - command exceeded per-command timeout
+var ErrCommandTimeout = errors.New("command timeout")
+
+// ErrHookTimeout - command was interrupted, hook invocation exceeded total timeout
+var ErrHookTimeout = errors.New("hook timeout")
+
+// returnCodeTimeout - return code set for killed on timeout command, same as used by timeout(1)
+const returnCodeTimeout = 124
+
+// HookContext - context of hook invocation, canceled when total hook timeout passes
+var HookContext = context.Background()
+
 // SanitizeInput - basic string input sanitisation
 func SanitizeInput(s string) string {
 	return strings.TrimSpace(strings.TrimSpace(strings.TrimRight(s, "\r\n")))
@@ -16,17 +32,87 @@ type RunCommandOutput struct {
 	Command        string
 	ReturnCode     int
 	CombinedOutput []byte
+	Duration       time.Duration
+	// ErrCommandTimeout or ErrHookTimeout, when command was killed on timeout
+	Timeout error
+}
+
+// Error - describes failed command, timeouts are wrapped so they can be detected with errors.Is
+func (o RunCommandOutput) Error(errPrefix string) error {
+	if o.Timeout != nil {
+		return fmt.Errorf("%s running command '%s' killed after %s: %w", errPrefix, o.Command, o.Duration.Round(time.Millisecond), o.Timeout)
+	}
+
+	return fmt.Errorf("%s running command '%s' failed with exit code '%d', output '%s'", errPrefix, o.Command, o.ReturnCode, o.CombinedOutput)
 }
 
-// RunCommand - wrapper to run command
+// IsTransient - reports whether failed command is worth retrying
+func (o RunCommandOutput) IsTransient() bool {
+	if o.ReturnCode == 0 {
+		return false
+	}
+
+	if o.Timeout != nil {
+		return errors.Is(o.Timeout, ErrCommandTimeout)
+	}
+
+	for _, s := range []string{
+		"Device or resource busy",
+		"Resource temporarily unavailable",
+		"No buffer space available",
+	} {
+		if strings.Contains(string(o.CombinedOutput), s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RunCommand - wrapper to run command within hook context, with configured timeout and retries
 func RunCommand(name string, arg ...string) RunCommandOutput {
+	t := c.GetTimeouts()
+
+	backoff := t.BackoffDuration()
+
+	for attempt := int64(0); ; attempt++ {
+		outputObj := RunCommandContext(HookContext, t.CommandDuration(), name, arg...)
+
+		if attempt >= t.Retries || !outputObj.IsTransient() || HookContext.Err() != nil {
+			return outputObj
+		}
+
+		Logger.Warn("retrying command",
+			"command", outputObj.Command,
+			"exit_code", outputObj.ReturnCode,
+			"duration", outputObj.Duration,
+			"attempt", attempt+1,
+			"backoff", backoff,
+		)
+
+		// wait before retry, but not past hook deadline
+		select {
+		case <-time.After(backoff):
+		case <-HookContext.Done():
+		}
+
+		backoff *= 2
+	}
+}
+
+// RunCommandContext - wrapper to run command, whole process group is killed when context is done or timeout passes
+func RunCommandContext(ctx context.Context, timeout time.Duration, name string, arg ...string) RunCommandOutput {
 	var (
 		outputObj RunCommandOutput
 		err       error
 	)
 
+	// per-command deadline, on top of parent context
+	cmdCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
 	// declare cmd object
-	cmd := exec.Command(name, arg...)
+	cmd := exec.CommandContext(cmdCtx, name, arg...)
 
 	// set full command as string, for logging purposes
 	if cmd.Args == nil || len(cmd.Args) == 0 {
@@ -40,8 +126,19 @@ func RunCommand(name string, arg ...string) RunCommandOutput {
 		Pdeathsig: syscall.SIGKILL,
 	}
 
+	// kill whole process group, not only direct child
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+
+	// do not wait forever for output pipes held open by orphaned grandchildren
+	cmd.WaitDelay = time.Second
+
 	// execute command, acquire command return code
+	start := time.Now()
 	outputObj.CombinedOutput, err = cmd.CombinedOutput()
+	outputObj.Duration = time.Since(start)
+
 	if err != nil {
 		outputObj.ReturnCode = 254 // set undefined return code
 		exitError, ok := err.(*exec.ExitError)
@@ -53,5 +150,15 @@ func RunCommand(name string, arg ...string) RunCommandOutput {
 		}
 	}
 
+	// killed on timeout, distinguish whole hook timeout from command timeout
+	if err != nil && cmdCtx.Err() != nil {
+		outputObj.ReturnCode = returnCodeTimeout
+		outputObj.Timeout = ErrCommandTimeout
+
+		if ctx.Err() != nil {
+			outputObj.Timeout = ErrHookTimeout
+		}
+	}
+
 	return outputObj
 }
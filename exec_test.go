@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRunCommandContext(t *testing.T) {
+	// canceled parent context, as on total hook timeout
+	expired, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	cases := []struct {
+		caseDescription string
+		ctx             context.Context
+		timeout         time.Duration
+		args            []string
+		returnCode      int   //out
+		err             error //out
+	}{
+		{"command succeeds", context.Background(), time.Second, []string{"true"}, 0, nil},
+		{"command fails", context.Background(), time.Second, []string{"sh", "-c", "exit 2"}, 2, nil},
+		{"command timeout", context.Background(), 100 * time.Millisecond, []string{"sleep", "10"}, 124, ErrCommandTimeout},
+		{"process group is killed", context.Background(), 100 * time.Millisecond, []string{"sh", "-c", "sleep 10 & sleep 10"}, 124, ErrCommandTimeout},
+		{"hook timeout", expired, 10 * time.Second, []string{"sleep", "10"}, 124, ErrHookTimeout},
+	}
+
+	for _, testCase := range cases {
+		out := RunCommandContext(testCase.ctx, testCase.timeout, testCase.args[0], testCase.args[1:]...)
+
+		if out.ReturnCode != testCase.returnCode {
+			t.Errorf("TestCase: %s\n Got : %d\n Want: %d\n", testCase.caseDescription, out.ReturnCode, testCase.returnCode)
+		}
+
+		if !errors.Is(out.Timeout, testCase.err) {
+			t.Errorf("TestCase: %s\n Got : %v\n Want: %v\n", testCase.caseDescription, out.Timeout, testCase.err)
+		}
+
+		if out.Duration > 5*time.Second {
+			t.Errorf("TestCase: %s\n Got : %s\n Want: killed in time\n", testCase.caseDescription, out.Duration)
+		}
+
+		if testCase.err != nil && !errors.Is(out.Error("test:"), testCase.err) {
+			t.Errorf("TestCase: %s\n Got : %s\n Want: wrapped %s\n", testCase.caseDescription, out.Error("test:"), testCase.err)
+		}
+	}
+}
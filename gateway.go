@@ -0,0 +1,70 @@
+package main
+
+import (
+	"reflect"
+)
+
+// gateway models, see `Gateway`
+const (
+	GatewayProxyARP  = "proxy-arp"
+	GatewayNetwork   = "network"
+	GatewayLinkLocal = "link-local"
+)
+
+// proxy neighbor modes, see `L3.ProxyNeighbors`
+const (
+	ProxyNeighborsNone   = "none"
+	ProxyNeighborsUplink = "uplink"
+)
+
+// LinkLocalGatewayV4 - IPv4 gateway of VM in `link-local` model, VM needs on-link route to it, answered by proxy ARP entry on upper peer and never assigned to host
+const LinkLocalGatewayV4 = "169.254.0.1"
+
+// LinkLocalGatewayV6 - IPv6 gateway of VM in `link-local` model
+const LinkLocalGatewayV6 = "fe80::1"
+
+// ModelV4 - IPv4 gateway model, `proxy-arp` when omitted
+func (g *Gateway) ModelV4() string {
+	if g == nil || g.IPv4 == "" {
+		return GatewayProxyARP
+	}
+
+	return g.IPv4
+}
+
+// ModelV6 - IPv6 gateway model, `network` when omitted
+func (g *Gateway) ModelV6() string {
+	if g == nil || g.IPv6 == "" {
+		return GatewayNetwork
+	}
+
+	return g.IPv6
+}
+
+// IsRouterV6 - host node routes IPv6 traffic of VM, true for every IPv6 model
+func (g *Gateway) IsRouterV6() bool {
+	switch g.ModelV6() {
+	case GatewayNetwork, GatewayLinkLocal:
+		return true
+	}
+
+	return false
+}
+
+// parentL3 - L3 holding validated field, nil when field belongs to other struct
+func parentL3(v reflect.Value) *L3 {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+
+		v = v.Elem()
+	}
+
+	l3, ok := v.Interface().(L3)
+	if !ok {
+		return nil
+	}
+
+	return &l3
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	libvirtxml "github.com/libvirt/libvirt-go-xml"
+)
+
+func TestGatewayValidation(t *testing.T) {
+	cases := []struct {
+		caseDescription string
+		ipv6            string
+		gateway         *Gateway
+		err             string
+	}{
+		{
+			caseDescription: "network address with network gateway",
+			ipv6:            "2a02:2278:100:1::",
+			err:             "failed on the 'notGW6' tag",
+		},
+		{
+			caseDescription: "network address with link-local gateway",
+			ipv6:            "2a02:2278:100:1::",
+			gateway:         &Gateway{IPv6: GatewayLinkLocal},
+		},
+		{
+			caseDescription: "network address with link-local IPv4 gateway only",
+			ipv6:            "2a02:2278:100:1::",
+			gateway:         &Gateway{IPv4: GatewayLinkLocal},
+			err:             "failed on the 'notGW6' tag",
+		},
+		{
+			caseDescription: "unknown model",
+			ipv6:            "2a02:2278:100:1::1",
+			gateway:         &Gateway{IPv4: "network"},
+			err:             "failed on the 'oneof' tag",
+		},
+	}
+
+	for _, testCase := range cases {
+		vm := VM{Interface: &Interface{
+			Uplink: &Iface{"bond-wan"},
+			L3: &L3{
+				Upper:   &Iface{"vu-9a0101"},
+				Source:  &Iface{"vl-9a0101"},
+				Target:  &Iface{"if-9a0101"},
+				TC:      &TC{Rate: 250, Burst: 256, Limit: 10240},
+				IPv4:    []string{"195.177.118.111"},
+				IPv6:    []string{testCase.ipv6},
+				Gateway: testCase.gateway,
+			},
+		}}
+
+		err := Validate.Struct(vm)
+		if testCase.err == "" {
+			if err != nil {
+				t.Errorf("TestCase: %s\n Got : %s\n Want: nil\n", testCase.caseDescription, err)
+			}
+
+			continue
+		}
+
+		if err == nil || !strings.Contains(err.Error(), testCase.err) {
+			t.Errorf("TestCase: %s\n Got : %v\n Want: %s\n", testCase.caseDescription, err, testCase.err)
+		}
+	}
+}
+
+func TestPrepareBeginHookGateway(t *testing.T) {
+	cases := []struct {
+		caseDescription string
+		gateway         *Gateway
+		want            []string
+		unwanted        []string
+	}{
+		{
+			caseDescription: "default models",
+			want: []string{
+				"sysctl /proc/sys/net/ipv4/conf/vu-9a0101/proxy_arp = 1",
+				"ip -6 addr add 2a02:2278:100:1::/64 dev vu-9a0101 noprefixroute nodad scope link",
+			},
+			unwanted: []string{
+				"ip -4 neigh add proxy 169.254.0.1 dev vu-9a0101",
+				"ip -6 addr add fe80::1/64 dev vu-9a0101 noprefixroute nodad",
+			},
+		},
+		{
+			caseDescription: "link-local models",
+			gateway:         &Gateway{IPv4: GatewayLinkLocal, IPv6: GatewayLinkLocal},
+			want: []string{
+				"ip -4 neigh add proxy 169.254.0.1 dev vu-9a0101",
+				"ip -6 addr add fe80::1/64 dev vu-9a0101 noprefixroute nodad",
+			},
+			unwanted: []string{
+				"sysctl /proc/sys/net/ipv4/conf/vu-9a0101/proxy_arp = 1",
+				"ip -6 addr add 2a02:2278:100:1::/64 dev vu-9a0101 noprefixroute nodad scope link",
+			},
+		},
+	}
+
+	for _, testCase := range cases {
+		cfg := &Config{VMs: map[string]VM{
+			"vm1": {Interface: &Interface{
+				Uplink: &Iface{"bond-wan"},
+				L3: &L3{
+					Upper:      &Iface{"vu-9a0101"},
+					Source:     &Iface{"vl-9a0101"},
+					Target:     &Iface{"if-9a0101"},
+					TC:         &TC{Rate: 250, Burst: 256, Limit: 10240},
+					IPv4:       []string{"195.177.118.111"},
+					IPv6Prefix: "2a02:2278:100:1::/64",
+					Gateway:    testCase.gateway,
+				},
+			}},
+		}}
+
+		s, r := NewRecordingSystem(t)
+
+		err := cfg.PrepareBeginHook(s, &libvirtxml.Domain{Name: "vm1", UUID: "8b5c4a64-4c44-4c4e-9d2d-4f7a1b7e0a01"})
+		if err != nil {
+			t.Fatalf("TestCase: %s\n Got : %s\n Want: nil", testCase.caseDescription, err)
+		}
+
+		ops := strings.Join(r.Ops, "\n") + "\n"
+
+		for _, op := range testCase.want {
+			if !strings.Contains(ops, op+"\n") {
+				t.Errorf("TestCase: %s\n Got :\n%s\n Want: %s\n", testCase.caseDescription, ops, op)
+			}
+		}
+
+		for _, op := range testCase.unwanted {
+			if strings.Contains(ops, op+"\n") {
+				t.Errorf("TestCase: %s\n Got :\n%s\n Want: no %s\n", testCase.caseDescription, ops, op)
+			}
+		}
+	}
+}
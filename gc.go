@@ -0,0 +1,310 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	libvirtxml "github.com/libvirt/libvirt-go-xml"
+)
+
+// LinkInfo - link as reported by `ip -j link show`
+type LinkInfo struct {
+	Name  string `json:"ifname"`
+	Alias string `json:"ifalias"`
+}
+
+// RouteInfo - route as reported by `ip -j route show`
+type RouteInfo struct {
+	// `-4` or `-6`, not reported by ip
+	Family string `json:"-"`
+	// route protocol of hook, not reported by ip when filtered by it
+	Protocol string `json:"-"`
+	Dst      string `json:"dst"`
+	Dev      string `json:"dev"`
+	// empty for main table
+	Table string `json:"table"`
+}
+
+// QdiscInfo - qdisc as reported by `tc -j qdisc show`
+type QdiscInfo struct {
+	Kind   string `json:"kind"`
+	Handle string `json:"handle"`
+	Dev    string `json:"dev"`
+	Root   bool   `json:"root"`
+}
+
+// Inventory - hook owned resources present on host node
+type Inventory struct {
+	Links  []LinkInfo
+	Routes []RouteInfo
+	Qdiscs []QdiscInfo
+	// UUIDs of domains with prefixes announced by BGP
+	BGP []string
+}
+
+// Owners - domains and interface names which keep hook owned resources alive
+type Owners struct {
+	// UUIDs of running domains and of domains between `prepare begin` and `release end`
+	Domains map[string]bool
+	// interface names referenced by running domains, their VM configs or shared devices with users
+	Names map[string]bool
+}
+
+// NewOwners - collects owners from running domains, VM config of each domain is resolved same way as hook does,
+// so domains selected by Match or with templated interface names keep their resources
+func NewOwners(domains []*libvirtxml.Domain, c *Config) Owners {
+	o := Owners{
+		Domains: make(map[string]bool),
+		Names:   make(map[string]bool),
+	}
+
+	for _, domCfg := range domains {
+		o.Domains[domCfg.UUID] = true
+
+		if domCfg.Devices != nil {
+			for _, iface := range domCfg.Devices.Interfaces {
+				if iface.Target != nil && iface.Target.Dev != "" {
+					o.Names[iface.Target.Dev] = true
+				}
+			}
+		}
+
+		if c == nil {
+			continue
+		}
+
+		// domain without VM config owns only links marked with its UUID
+		_, vm, err := c.FindVM(domCfg)
+		if err != nil {
+			continue
+		}
+
+		vm, err = c.EffectiveVM(vm, domCfg)
+		if err != nil || vm.Interface == nil {
+			continue
+		}
+
+		for _, iface := range vm.Interface.Ifaces() {
+			o.Names[iface.Name] = true
+		}
+	}
+
+	return o
+}
+
+// GetOwners - owners of running domains, domains in lifecycle and shared devices still used by them
+func (s *System) GetOwners(domains []*libvirtxml.Domain, c *Config) (Owners, error) {
+	o := NewOwners(domains, c)
+
+	// domains prepared by hook, libvirt lists domain as running only after `start begin`
+	active, err := s.Active().Devices()
+	if err != nil {
+		return o, err
+	}
+
+	for _, uuid := range active {
+		o.Domains[uuid] = true
+	}
+
+	// shared devices with users
+	shared, err := s.Refs().Devices()
+	if err != nil {
+		return o, err
+	}
+
+	for _, name := range shared {
+		o.Names[name] = true
+	}
+
+	return o, nil
+}
+
+// Ifaces - all interfaces referenced by VM interfaces configuration
+func (i *Interface) Ifaces() []*Iface {
+	ifaces := []*Iface{i.Uplink}
+
+	if i.L3 != nil {
+		ifaces = append(ifaces, i.L3.Upper, i.L3.Source, i.L3.Target)
+	}
+
+	if i.VxLAN != nil {
+		ifaces = append(ifaces, i.VxLAN.Source, i.VxLAN.Target)
+	}
+
+	// skip non-defined interfaces
+	out := make([]*Iface, 0, len(ifaces))
+	for _, iface := range ifaces {
+		if iface != nil && iface.Name != "" {
+			out = append(out, iface)
+		}
+	}
+
+	return out
+}
+
+// Orphans - filters inventory down to hook owned resources that belong to no owner
+func (inv Inventory) Orphans(o Owners) Inventory {
+	var orphans Inventory
+
+	// links which are still in use, routes and qdiscs on them are kept
+	kept := make(map[string]bool)
+
+	// links
+	for _, link := range inv.Links {
+		marker, ok := ParseMarker(link.Alias)
+		if !ok {
+			continue
+		}
+
+		if o.Names[link.Name] || (!marker.IsShared() && o.Domains[marker.UUID]) {
+			kept[link.Name] = true
+
+			continue
+		}
+
+		orphans.Links = append(orphans.Links, link)
+	}
+
+	// routes
+	for _, route := range inv.Routes {
+		if o.Names[route.Dev] || kept[route.Dev] {
+			continue
+		}
+
+		orphans.Routes = append(orphans.Routes, route)
+	}
+
+	// qdiscs
+	for _, qdisc := range inv.Qdiscs {
+		if !qdisc.Root || qdisc.Handle != HookQdiscHandle+":" {
+			continue
+		}
+
+		if o.Names[qdisc.Dev] || kept[qdisc.Dev] {
+			continue
+		}
+
+		orphans.Qdiscs = append(orphans.Qdiscs, qdisc)
+	}
+
+	// BGP announcements of domains died without `release end`
+	for _, uuid := range inv.BGP {
+		if !o.Domains[uuid] {
+			orphans.BGP = append(orphans.BGP, uuid)
+		}
+	}
+
+	return orphans
+}
+
+// GetInventory - lists hook owned resources present on host node, routes of hook are found by protocol in any table
+func (s *System) GetInventory(rt Routing) (Inventory, error) {
+	// prefix for errors logging
+	const errPrefix = "gc error:"
+
+	var inv Inventory
+
+	// links, filtered by marker later
+	cmd := s.run("ip", "-j", "link", "show")
+	if cmd.ReturnCode != 0 {
+		return inv, cmd.Error(errPrefix)
+	}
+
+	err := json.Unmarshal(cmd.CombinedOutput, &inv.Links)
+	if err != nil {
+		return inv, fmt.Errorf("%s decoding output of '%s': %s", errPrefix, cmd.Command, err)
+	}
+
+	// routes, filtered by hook route protocol
+	for _, family := range []string{"-4", "-6"} {
+		var routes []RouteInfo
+
+		cmd = s.run("ip", "-j", family, "route", "show", "table", "all", "proto", rt.ProtocolArg())
+		if cmd.ReturnCode != 0 {
+			return inv, cmd.Error(errPrefix)
+		}
+
+		err = json.Unmarshal(cmd.CombinedOutput, &routes)
+		if err != nil {
+			return inv, fmt.Errorf("%s decoding output of '%s': %s", errPrefix, cmd.Command, err)
+		}
+
+		for i := range routes {
+			routes[i].Family = family
+			routes[i].Protocol = rt.ProtocolArg()
+		}
+
+		inv.Routes = append(inv.Routes, routes...)
+	}
+
+	// qdiscs, filtered by handle later
+	cmd = s.run("tc", "-j", "qdisc", "show")
+	if cmd.ReturnCode != 0 {
+		return inv, cmd.Error(errPrefix)
+	}
+
+	err = json.Unmarshal(cmd.CombinedOutput, &inv.Qdiscs)
+	if err != nil {
+		return inv, fmt.Errorf("%s decoding output of '%s': %s", errPrefix, cmd.Command, err)
+	}
+
+	// BGP state files, filtered by owner later
+	inv.BGP, err = s.BGPRoutes().Domains()
+	if err != nil {
+		return inv, fmt.Errorf("%s %s", errPrefix, err)
+	}
+
+	return inv, nil
+}
+
+// RemoveOrphans - removes orphaned hook owned resources, BGP announcements, qdiscs and routes first, then links
+func (s *System) RemoveOrphans(orphans Inventory) error {
+	// prefix for errors logging
+	const errPrefix = "gc error:"
+
+	var failed []string
+
+	// `qemu bgp` daemon withdraws prefixes on next poll
+	for _, uuid := range orphans.BGP {
+		err := s.BGPRoutes().Withdraw(uuid)
+		if err != nil {
+			failed = append(failed, err.Error())
+		}
+	}
+
+	for _, qdisc := range orphans.Qdiscs {
+		cmd := s.run("tc", "qdisc", "del", "dev", SanitizeInput(qdisc.Dev), "root")
+		if cmd.ReturnCode != 0 && cmd.ReturnCode != 2 { // return code 2 is for RTNETLINK answers: No such file or directory
+			failed = append(failed, cmd.Command)
+		}
+	}
+
+	for _, route := range orphans.Routes {
+		args := []string{route.Family, "route", "del", SanitizeInput(route.Dst), "dev", SanitizeInput(route.Dev), "proto", SanitizeInput(route.Protocol)}
+		if route.Table != "" {
+			args = append(args, "table", SanitizeInput(route.Table))
+		}
+
+		cmd := s.run("ip", args...)
+		if cmd.ReturnCode != 0 && cmd.ReturnCode != 2 { // return code 2 is for RTNETLINK answers: No such process
+			failed = append(failed, cmd.Command)
+		}
+	}
+
+	for _, link := range orphans.Links {
+		cmd := s.run("ip", "link", "del", "dev", SanitizeInput(link.Name))
+		if cmd.ReturnCode != 0 && cmd.ReturnCode != 1 { // return code 1 is for peer removed together with its veth pair
+			failed = append(failed, cmd.Command)
+		}
+	}
+
+	if len(failed) != 0 {
+		e := fmt.Errorf("%s failed: '%s'", errPrefix, strings.Join(failed, "', '"))
+		s.logger().Error(e.Error())
+
+		return e
+	}
+
+	return nil
+}
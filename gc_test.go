@@ -0,0 +1,242 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	libvirtxml "github.com/libvirt/libvirt-go-xml"
+)
+
+func TestOrphans(t *testing.T) {
+	owners := Owners{
+		Domains: map[string]bool{
+			"8b5c4a64-4c44-4c4e-9d2d-4f7a1b7e0a01": true,
+		},
+		Names: map[string]bool{
+			"x-42":      true,
+			"vu-9a0102": true,
+			"if-9a0101": true,
+		},
+	}
+
+	inv := Inventory{
+		Links: []LinkInfo{
+			{Name: "bond-wan"},
+			{Name: "x-42", Alias: "qemu-hook:shared"},
+			{Name: "x-43", Alias: "qemu-hook:shared"},
+			{Name: "vu-9a0101", Alias: "qemu-hook:8b5c4a64-4c44-4c4e-9d2d-4f7a1b7e0a01:vm1"},
+			{Name: "vu-9a0102", Alias: "qemu-hook:00000000-0000-0000-0000-000000000002:vm2"},
+			{Name: "vu-9a0103", Alias: "qemu-hook:00000000-0000-0000-0000-000000000003:vm3"},
+			{Name: "vu-9a0105", Alias: "qemu-hook:00000000-0000-0000-0000-000000000005:vm1"},
+			{Name: "eth0", Alias: "qemu-hook-like alias"},
+		},
+		Routes: []RouteInfo{
+			{Family: "-4", Dst: "195.177.118.111", Dev: "vu-9a0101"},
+			{Family: "-4", Dst: "195.177.118.113", Dev: "vu-9a0103"},
+			{Family: "-6", Dst: "2a02:2278:100:3::1", Dev: "vu-9a0104"},
+		},
+		Qdiscs: []QdiscInfo{
+			{Kind: "tbf", Handle: "4843:", Dev: "if-9a0101", Root: true},
+			{Kind: "tbf", Handle: "4843:", Dev: "if-9a0103", Root: true},
+			{Kind: "fq_codel", Handle: "10:", Dev: "if-9a0103"},
+			{Kind: "noqueue", Handle: "0:", Dev: "bond-wan", Root: true},
+		},
+		BGP: []string{
+			"8b5c4a64-4c44-4c4e-9d2d-4f7a1b7e0a01",
+			"00000000-0000-0000-0000-000000000003",
+		},
+	}
+
+	want := Inventory{
+		Links: []LinkInfo{
+			{Name: "x-43", Alias: "qemu-hook:shared"},
+			{Name: "vu-9a0103", Alias: "qemu-hook:00000000-0000-0000-0000-000000000003:vm3"},
+			// same name as running domain, but other UUID
+			{Name: "vu-9a0105", Alias: "qemu-hook:00000000-0000-0000-0000-000000000005:vm1"},
+		},
+		Routes: []RouteInfo{
+			{Family: "-4", Dst: "195.177.118.113", Dev: "vu-9a0103"},
+			{Family: "-6", Dst: "2a02:2278:100:3::1", Dev: "vu-9a0104"},
+		},
+		Qdiscs: []QdiscInfo{
+			{Kind: "tbf", Handle: "4843:", Dev: "if-9a0103", Root: true},
+		},
+		BGP: []string{"00000000-0000-0000-0000-000000000003"},
+	}
+
+	got := inv.Orphans(owners)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("\n Got : %+v\n Want: %+v\n", got, want)
+	}
+}
+
+func TestGetOwners(t *testing.T) {
+	s, _ := NewRecordingSystem(t)
+
+	cfg := &Config{
+		Naming: &Naming{},
+		VMs: map[string]VM{
+			// selected by pattern, interface names derived from UUID
+			"runners": {
+				Match: &Match{Name: "ci-runner-*"},
+				Interface: &Interface{
+					VxLAN:  &VxLAN{VNI: 42, Source: &Iface{"x-42"}},
+					L3:     &L3{IPv4: []string{"195.177.118.111"}},
+					Uplink: &Iface{"bond-wan"},
+				},
+			},
+			// configured, but not running
+			"vm2": {
+				Interface: &Interface{
+					L3:     &L3{Upper: &Iface{"vu-9a0102"}},
+					Uplink: &Iface{"bond-wan"},
+				},
+			},
+		},
+	}
+
+	running := &libvirtxml.Domain{Name: "ci-runner-1", UUID: "8b5c4a64-4c44-4c4e-9d2d-4f7a1b7e0a01"}
+	upper := RenderName(DefaultNaming.Upper, running.UUID)
+	target := RenderName(DefaultNaming.Target, running.UUID)
+
+	// prepared, libvirt has not started it yet
+	prepared := "8b5c4a64-4c44-4c4e-9d2d-4f7a1b7e0a03"
+
+	_, err := s.Active().Acquire(prepared, prepared)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.Refs().Acquire("x-43", prepared)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	owners, err := s.GetOwners([]*libvirtxml.Domain{running}, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inv := Inventory{
+		Links: []LinkInfo{
+			{Name: "x-42", Alias: "qemu-hook:shared"},
+			{Name: "x-43", Alias: "qemu-hook:shared"},
+			{Name: "x-44", Alias: "qemu-hook:shared"},
+			{Name: upper, Alias: "qemu-hook:" + running.UUID + ":" + running.Name},
+			{Name: "vu-9a0102", Alias: "qemu-hook:00000000-0000-0000-0000-000000000002:vm2"},
+			{Name: "vu-9a0103", Alias: "qemu-hook:" + prepared + ":vm3"},
+		},
+		Qdiscs: []QdiscInfo{
+			{Kind: "tbf", Handle: "4843:", Dev: target, Root: true},
+		},
+	}
+
+	want := Inventory{
+		Links: []LinkInfo{
+			{Name: "x-44", Alias: "qemu-hook:shared"},
+			{Name: "vu-9a0102", Alias: "qemu-hook:00000000-0000-0000-0000-000000000002:vm2"},
+		},
+	}
+
+	got := inv.Orphans(owners)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("\n Got : %+v\n Want: %+v\n", got, want)
+	}
+}
+
+func TestParseMarker(t *testing.T) {
+	cases := []struct {
+		alias  string
+		marker Marker
+		ok     bool
+	}{
+		{"qemu-hook:shared", Marker{}, true},
+		{"qemu-hook:8b5c4a64-4c44-4c4e-9d2d-4f7a1b7e0a01:vm:1", Marker{"8b5c4a64-4c44-4c4e-9d2d-4f7a1b7e0a01", "vm:1"}, true},
+		{"qemu-hook:other", Marker{}, false},
+		{"other:8b5c4a64-4c44-4c4e-9d2d-4f7a1b7e0a01:vm1", Marker{}, false},
+		{"", Marker{}, false},
+	}
+
+	for _, testCase := range cases {
+		marker, ok := ParseMarker(testCase.alias)
+		if ok != testCase.ok || marker != testCase.marker {
+			t.Errorf("TestCase: %s\n Got : %+v, %t\n Want: %+v, %t\n", testCase.alias, marker, ok, testCase.marker, testCase.ok)
+		}
+
+		if ok && marker.String() != testCase.alias {
+			t.Errorf("TestCase: %s\n Got : %s\n", testCase.alias, marker)
+		}
+	}
+}
+
+func TestGarbageCollectRouting(t *testing.T) {
+	s, r := NewRecordingSystem(t)
+
+	r.Outputs["ip -j link show"] = `[]`
+	r.Outputs["ip -j -4 route show table all proto 201"] = `[{"dst":"195.177.118.113","dev":"vu-9a0103","flags":[]},` +
+		`{"dst":"195.177.118.114","dev":"vu-9a0104","table":"100","flags":[]}]`
+	r.Outputs["ip -j -6 route show table all proto 201"] = `[]`
+	r.Outputs["tc -j qdisc show"] = `[]`
+
+	inv, err := s.GetInventory(Routing{Protocol: 201, Table: 100})
+	if err != nil {
+		t.Fatalf("Got : %s\n Want: nil", err)
+	}
+
+	err = s.RemoveOrphans(inv.Orphans(Owners{}))
+	if err != nil {
+		t.Fatalf("Got : %s\n Want: nil", err)
+	}
+
+	// routes are found in any table, main table is not named
+	want := []string{
+		"ip -j link show",
+		"ip -j -4 route show table all proto 201",
+		"ip -j -6 route show table all proto 201",
+		"tc -j qdisc show",
+		"ip -4 route del 195.177.118.113 dev vu-9a0103 proto 201",
+		"ip -4 route del 195.177.118.114 dev vu-9a0104 proto 201 table 100",
+	}
+
+	if !reflect.DeepEqual(r.Ops, want) {
+		t.Errorf("\n Got : %q\n Want: %q\n", r.Ops, want)
+	}
+}
+
+func TestGarbageCollectBGP(t *testing.T) {
+	s, r := NewRecordingSystem(t)
+
+	r.Outputs["ip -j link show"] = `[]`
+	r.Outputs["ip -j -4 route show table all proto 220"] = `[]`
+	r.Outputs["ip -j -6 route show table all proto 220"] = `[]`
+	r.Outputs["tc -j qdisc show"] = `[]`
+
+	for _, uuid := range []string{"8b5c4a64-4c44-4c4e-9d2d-4f7a1b7e0a01", "00000000-0000-0000-0000-000000000003"} {
+		err := s.AnnounceVMRoutes(uuid, []string{"195.177.118.111/32"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	inv, err := s.GetInventory(Routing{})
+	if err != nil {
+		t.Fatalf("Got : %s\n Want: nil", err)
+	}
+
+	// domain died without `release end`
+	err = s.RemoveOrphans(inv.Orphans(Owners{Domains: map[string]bool{"8b5c4a64-4c44-4c4e-9d2d-4f7a1b7e0a01": true}}))
+	if err != nil {
+		t.Fatalf("Got : %s\n Want: nil", err)
+	}
+
+	got, err := s.BGPRoutes().Domains()
+	if err != nil {
+		t.Fatalf("Got : %s\n Want: nil", err)
+	}
+
+	want := []string{"8b5c4a64-4c44-4c4e-9d2d-4f7a1b7e0a01"}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("\n Got : %q\n Want: %q\n", got, want)
+	}
+}
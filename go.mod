@@ -3,6 +3,8 @@ module github.com/s3rj1k/go-libvirt-custom-hook
 go 1.23.4
 
 require (
+	github.com/BurntSushi/toml v1.6.0
+	github.com/goccy/go-yaml v1.19.2
 	github.com/libvirt/libvirt-go-xml v7.4.0+incompatible
 	gopkg.in/go-playground/validator.v9 v9.31.0
 )
@@ -6,86 +6,109 @@ import (
 	libvirtxml "github.com/libvirt/libvirt-go-xml"
 )
 
-// LookupVMConfig - wrapper to get VM configuration by 'UUID' first and if this failes try to lookup by 'Name'
+// LookupVMConfig - wrapper to get VM configuration by 'UUID' first, then by 'Name', then by VM selectors
 func (c *Config) LookupVMConfig(domCfg *libvirtxml.Domain) (VM, error) {
-	var ok bool
-
-	// declare variable for VM configuration description
-	var vm VM
-
 	// prefix for errors logging
 	const errPrefix = "vm config error:"
 
-	// check config for defined VM by UUID
-	vm, ok = c.VMs[domCfg.UUID]
-	if ok {
-		// run validator on VM config
-		err := Validate.Struct(vm)
-		if err != nil {
-			// log error, invalid config
-			e := fmt.Errorf("%s %s", errPrefix, err.Error())
-			Logger.Println(e)
+	// lookup VM config by UUID, Name or selector
+	name, vm, err := c.FindVM(domCfg)
+	if err != nil {
+		// log error, no VM in config
+		e := fmt.Errorf("%s %s", errPrefix, err)
+		Logger.Error(e.Error())
 
-			return VM{}, e
-		}
+		return VM{}, e
+	}
 
-		return vm, nil
+	Logger.Debug("vm config found", "vm", name, "source", vm.Source)
+
+	// complete VM config from domain
+	effective, err := c.EffectiveVM(vm, domCfg)
+	if err != nil {
+		// log error, config does not match domain XML
+		e := fmt.Errorf("%s %s: %s", errPrefix, vm.Source, err.Error())
+		Logger.Error(e.Error())
+
+		return VM{}, e
 	}
 
-	// check config for defined VM by Name
-	vm, ok = c.VMs[domCfg.Name]
-	if ok {
-		// run validator on VM config
-		err := Validate.Struct(vm)
-		if err != nil {
-			// log error, invalid config
-			e := fmt.Errorf("%s %s", errPrefix, err.Error())
-			Logger.Println(e)
+	vm = effective
 
-			return VM{}, e
-		}
+	// run validator on VM config
+	err = Validate.Struct(vm)
+	if err != nil {
+		// log error, invalid config, failed fields are located in file VM is defined in
+		e := fmt.Errorf("%s %s", errPrefix, c.LocateValidation(vm.Source, "VMs."+name, err))
+		Logger.Error(e.Error())
 
-		return vm, nil
+		return VM{}, e
 	}
 
-	// log error, no VM in config
-	e := fmt.Errorf("%s no VM found in config for UUID='%s' or Name='%s'", errPrefix, domCfg.UUID, domCfg.Name)
-	Logger.Println(e)
+	return vm, nil
+}
+
+// EffectiveVM - VM config completed from domain: omitted interface names are derived from UUID, taps of bound NICs are taken from domain XML
+func (c *Config) EffectiveVM(vm VM, domCfg *libvirtxml.Domain) (VM, error) {
+	vm = c.Naming.Apply(vm, domCfg.UUID)
 
-	return VM{}, e
+	bound, err := BindNICs(vm, domCfg)
+	if err != nil {
+		return VM{}, fmt.Errorf("domain XML mismatch: %s", err)
+	}
+
+	return bound, nil
 }
 
 // PrepareBeginHook - hook for `qemu vm1 prepare begin -`
-func (c *Config) PrepareBeginHook(domCfg *libvirtxml.Domain) error {
+func (c *Config) PrepareBeginHook(s *System, domCfg *libvirtxml.Domain) error {
+	// serialize with concurrent hook invocations for same domain and with gc
+	unlock, err := s.Step("lock").LockDomain(domCfg.UUID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// domain owns its resources from now until `release end`, also while it is not running yet
+	_, err = s.Active().Acquire(domCfg.UUID, domCfg.UUID)
+	if err != nil {
+		return err
+	}
+
 	// lookup VM config
-	vm, err := c.LookupVMConfig(domCfg)
+	var vm VM
+
+	vm, err = c.LookupVMConfig(domCfg)
 	if err != nil {
 		return err
 	}
 
 	// Validate Uplink interface existence
-	if !IsInterfaceExists(vm.Interface.Uplink.Name) {
+	uplink := s.Step("uplink")
+	if !uplink.IsInterfaceExists(vm.Interface.Uplink.Name) {
 		return fmt.Errorf("hook: uplink interface '%s' does not exist", vm.Interface.Uplink.Name)
 	}
 
 	// Uplink v4
-	err = EnableIPv4ForwardingOnInterface(vm.Interface.Uplink.Name)
+	err = uplink.EnableIPv4ForwardingOnInterface(vm.Interface.Uplink.Name)
 	if err != nil {
 		return err
 	}
 
 	// Uplink v6
-	err = EnableIPv6ForwardingOnInterface(vm.Interface.Uplink.Name)
+	err = uplink.EnableIPv6ForwardingOnInterface(vm.Interface.Uplink.Name)
 	if err != nil {
 		return err
 	}
 
 	// VxLAN
 	if vm.Interface.VxLAN != nil { // skip for Non-Defined VxLAN
-		err = CreateVxLANInterface(
+		err = s.Step("vxlan").AcquireVxLANInterface(
 			vm.Interface.VxLAN.Source.Name,
 			vm.Interface.VxLAN.VNI,
 			vm.Interface.Uplink.Name,
+			vm.Interface.VxLAN.Local,
+			domCfg.UUID,
 		)
 		if err != nil {
 			return err
@@ -93,68 +116,165 @@ func (c *Config) PrepareBeginHook(domCfg *libvirtxml.Domain) error {
 	}
 
 	// Veth
-	err = CreateVethInterface(
+	err = s.Step("veth").CreateVethInterface(
 		vm.Interface.L3.Upper.Name,
 		vm.Interface.L3.Source.Name,
+		NewMarker(domCfg.UUID, domCfg.Name),
 	)
 	if err != nil {
 		return err
 	}
 
 	// IPv4
+	gw := vm.Interface.L3.Gateway
+
+	step := s.Step("ipv4")
 	for _, ipv4 := range vm.Interface.L3.IPv4 {
-		err = AddStaticV4Route(ipv4, vm.Interface.L3.Upper.Name)
+		err = step.AddStaticV4Route(ipv4, vm.Interface.L3.Upper.Name, c.GetRouting())
 		if err != nil {
 			return err
 		}
 
-		err = EnableIPv4ProxyARPOnInterface(vm.Interface.L3.Upper.Name)
+		if gw.ModelV4() == GatewayProxyARP {
+			err = step.EnableIPv4ProxyARPOnInterface(vm.Interface.L3.Upper.Name)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = step.EnableIPv4ForwardingOnInterface(vm.Interface.L3.Upper.Name)
 		if err != nil {
 			return err
 		}
+	}
 
-		err = EnableIPv4ForwardingOnInterface(vm.Interface.L3.Upper.Name)
+	// IPv4 link-local gateway
+	if gw.ModelV4() == GatewayLinkLocal && len(vm.Interface.L3.IPv4) != 0 {
+		err = step.AddLinkLocalGatewayV4(vm.Interface.L3.Upper.Name)
+		if err != nil {
+			return err
+		}
+	}
+
+	// IPv4 routed prefixes, after host routes of their next hops
+	step = s.Step("routes4")
+	for _, route := range vm.Interface.L3.Routes {
+		err = step.AddRoutedV4Prefix(route.Prefix, route.Via, vm.Interface.L3.Upper.Name, c.GetRouting())
 		if err != nil {
 			return err
 		}
 	}
 
 	// IPv6
+	step = s.Step("ipv6")
 	for _, ipv6 := range vm.Interface.L3.IPv6 {
-		err = AddStaticV6Route(ipv6, vm.Interface.L3.Upper.Name)
+		err = step.AddStaticV6Route(ipv6, vm.Interface.L3.Upper.Name, c.GetRouting())
+		if err != nil {
+			return err
+		}
+
+		if gw.ModelV6() == GatewayNetwork {
+			err = step.AddVMGatewayForIPv6(ipv6, vm.Interface.L3.Upper.Name)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = step.EnableIPv6ProxyNDPOnInterface(vm.Interface.L3.Upper.Name)
+		if err != nil {
+			return err
+		}
+
+		err = step.EnableIPv6ForwardingOnInterface(vm.Interface.L3.Upper.Name)
+		if err != nil {
+			return err
+		}
+	}
+
+	// IPv6 on-link prefix, network address on upper peer is gateway of VM in `network` model
+	step = s.Step("prefix6")
+	if prefix := vm.Interface.L3.IPv6Prefix; prefix != "" {
+		err = step.AddOnLinkV6Prefix(prefix, vm.Interface.L3.Upper.Name, c.GetRouting())
+		if err != nil {
+			return err
+		}
+
+		if gw.ModelV6() == GatewayNetwork {
+			err = step.AddVMGatewayForIPv6(GetPrefixAddress(prefix), vm.Interface.L3.Upper.Name)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = step.EnableIPv6ProxyNDPOnInterface(vm.Interface.L3.Upper.Name)
 		if err != nil {
 			return err
 		}
 
-		err = AddVMGatewayForIPv6(ipv6, vm.Interface.L3.Upper.Name)
+		err = step.EnableIPv6ForwardingOnInterface(vm.Interface.L3.Upper.Name)
 		if err != nil {
 			return err
 		}
+	}
 
-		err = EnableIPv6ProxyNDPOnInterface(vm.Interface.L3.Upper.Name)
+	// IPv6 link-local gateway
+	if gw.ModelV6() == GatewayLinkLocal && (len(vm.Interface.L3.IPv6) != 0 || vm.Interface.L3.IPv6Prefix != "") {
+		err = s.Step("ipv6").AddLinkLocalGatewayV6(vm.Interface.L3.Upper.Name)
 		if err != nil {
 			return err
 		}
+	}
 
-		err = EnableIPv6ForwardingOnInterface(vm.Interface.L3.Upper.Name)
+	// IPv6 delegated prefixes, after routes of their next hops
+	step = s.Step("routes6")
+	for _, route := range vm.Interface.L3.IPv6Delegated {
+		err = step.AddRoutedV6Prefix(route.Prefix, route.Via, vm.Interface.L3.Upper.Name, c.GetRouting())
 		if err != nil {
 			return err
 		}
 	}
 
+	// proxy neighbors on uplink, after routes to VM addresses
+	if vm.Interface.L3.ProxyNeighbors == ProxyNeighborsUplink {
+		step = s.Step("neigh")
+
+		if len(vm.Interface.L3.IPv6) != 0 {
+			err = step.EnableIPv6ProxyNDPOnInterface(vm.Interface.Uplink.Name)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, ip := range vm.Interface.L3.Addresses() {
+			err = step.AddProxyNeighbor(ip, vm.Interface.Uplink.Name)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
 	return nil
 }
 
 // StartedBeginHook - hook for `qemu vm1 started begin -`
-func (c *Config) StartedBeginHook(domCfg *libvirtxml.Domain) error {
+func (c *Config) StartedBeginHook(s *System, domCfg *libvirtxml.Domain) error {
+	// serialize with concurrent hook invocations for same domain and with gc
+	unlock, err := s.Step("lock").LockDomain(domCfg.UUID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	// lookup VM config
-	vm, err := c.LookupVMConfig(domCfg)
+	var vm VM
+
+	vm, err = c.LookupVMConfig(domCfg)
 	if err != nil {
 		return err
 	}
 
 	// TC on L3
-	err = ConfigureTrafficControlOnInterface(
+	err = s.Step("tc-l3").ConfigureTrafficControlOnInterface(
 		vm.Interface.L3.TC.Rate,
 		vm.Interface.L3.TC.Burst,
 		vm.Interface.L3.TC.Limit,
@@ -165,8 +285,8 @@ func (c *Config) StartedBeginHook(domCfg *libvirtxml.Domain) error {
 	}
 
 	// TC on VxLAN
-	if vm.Interface.VxLAN.VNI != 0 { // skip for Non-Defined VxLAN VNI
-		err = ConfigureTrafficControlOnInterface(
+	if vm.Interface.VxLAN != nil { // skip for Non-Defined VxLAN
+		err = s.Step("tc-vxlan").ConfigureTrafficControlOnInterface(
 			vm.Interface.VxLAN.TC.Rate,
 			vm.Interface.VxLAN.TC.Burst,
 			vm.Interface.VxLAN.TC.Limit,
@@ -177,17 +297,120 @@ func (c *Config) StartedBeginHook(domCfg *libvirtxml.Domain) error {
 		}
 	}
 
+	// BGP announcement, only once VM runs, so incoming migration does not attract traffic early
+	if c.BGP != nil {
+		err = s.Step("bgp").AnnounceVMRoutes(domCfg.UUID, vm.Interface.L3.AnnouncedPrefixes())
+		if err != nil {
+			return err
+		}
+	}
+
+	// announce VM addresses on uplink, best effort, stale caches expire anyway
+	if vm.Interface.L3.Announce != nil {
+		step := s.Step("announce")
+
+		err = step.AnnounceAddresses(
+			vm.Interface.Uplink.Name,
+			vm.Interface.L3.IPv4,
+			vm.Interface.L3.IPv6,
+			vm.Interface.L3.Gateway.IsRouterV6(),
+			vm.Interface.L3.Announce,
+		)
+		if err != nil {
+			step.logger().Warn(err.Error())
+		}
+	}
+
 	return nil
 }
 
 // StoppedEndHook - hook for `qemu vm1 stopped end -`
-func (c *Config) StoppedEndHook(domCfg *libvirtxml.Domain) error {
+func (c *Config) StoppedEndHook(s *System, domCfg *libvirtxml.Domain) error {
+	// serialize with concurrent hook invocations for same domain and with gc
+	unlock, err := s.Step("lock").LockDomain(domCfg.UUID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	// lookup VM config
-	vm, err := c.LookupVMConfig(domCfg)
+	var vm VM
+
+	vm, err = c.LookupVMConfig(domCfg)
+	if err != nil {
+		return err
+	}
+
+	// BGP announcement, withdrawn even when BGP is no longer configured
+	err = s.Step("bgp").WithdrawVMRoutes(domCfg.UUID)
 	if err != nil {
 		return err
 	}
 
+	// proxy neighbors on uplink, uplink outlives VM
+	step := s.Step("neigh")
+	if vm.Interface.L3.ProxyNeighbors == ProxyNeighborsUplink {
+		for _, ip := range vm.Interface.L3.Addresses() {
+			err = step.DelProxyNeighbor(ip, vm.Interface.Uplink.Name)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// IPv6 delegated prefixes, before their next hops are gone with veth
+	step = s.Step("routes6")
+	for _, route := range vm.Interface.L3.IPv6Delegated {
+		err = step.DelRoutedV6Prefix(route.Prefix, route.Via, vm.Interface.L3.Upper.Name, c.GetRouting())
+		if err != nil {
+			return err
+		}
+	}
+
+	// IPv6 on-link prefix
+	if prefix := vm.Interface.L3.IPv6Prefix; prefix != "" {
+		err = s.Step("prefix6").DelOnLinkV6Prefix(prefix, vm.Interface.L3.Upper.Name, c.GetRouting())
+		if err != nil {
+			return err
+		}
+	}
+
+	// IPv4 routed prefixes, before their next hops are gone with veth
+	step = s.Step("routes4")
+	for _, route := range vm.Interface.L3.Routes {
+		err = step.DelRoutedV4Prefix(route.Prefix, route.Via, vm.Interface.L3.Upper.Name, c.GetRouting())
+		if err != nil {
+			return err
+		}
+	}
+
 	// Veth
-	return DestroyVethInterface(vm.Interface.L3.Upper.Name)
+	return s.Step("veth").DestroyVethInterface(vm.Interface.L3.Upper.Name)
+}
+
+// ReleaseEndHook - hook for `qemu vm1 release end -`
+func (c *Config) ReleaseEndHook(s *System, domCfg *libvirtxml.Domain) error {
+	// serialize with concurrent hook invocations for same domain and with gc
+	unlock, err := s.Step("lock").LockDomain(domCfg.UUID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// leftovers of domain are collected by gc from now on
+	_, err = s.Active().Release(domCfg.UUID, domCfg.UUID)
+	if err != nil {
+		return err
+	}
+
+	// state below is keyed by domain UUID, VM config is not needed, so VM removed from config is released too
+
+	// BGP announcement, in case stopped hook did not run
+	err = s.Step("bgp").WithdrawVMRoutes(domCfg.UUID)
+	if err != nil {
+		return err
+	}
+
+	// VxLAN
+	return s.Step("vxlan").ReleaseVxLANInterfaces(domCfg.UUID)
 }
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	libvirtxml "github.com/libvirt/libvirt-go-xml"
+)
+
+// update golden files with `go test -run TestHookGolden -update`
+var update = flag.Bool("update", false, "update golden files")
+
+// Recorder - fake Runner and SysctlStore, records every operation instead of touching host node
+type Recorder struct {
+	Ops []string
+	// return codes for commands, keyed by full command, zero by default
+	ReturnCodes map[string]int
+	// outputs of commands, keyed by full command, empty by default
+	Outputs map[string]string
+	// sysctl values, unset values read as "0"
+	Sysctls map[string]string
+}
+
+// NewRecorder - returns empty Recorder
+func NewRecorder() *Recorder {
+	return &Recorder{
+		ReturnCodes: make(map[string]int),
+		Outputs:     make(map[string]string),
+		Sysctls:     make(map[string]string),
+	}
+}
+
+// Run - records command
+func (r *Recorder) Run(name string, arg ...string) RunCommandOutput {
+	command := strings.Join(append([]string{name}, arg...), " ")
+	r.Ops = append(r.Ops, command)
+
+	return RunCommandOutput{
+		Command:        command,
+		ReturnCode:     r.ReturnCodes[command],
+		CombinedOutput: []byte(r.Outputs[command]),
+	}
+}
+
+// Get - reads recorded sysctl value
+func (r *Recorder) Get(path string) (string, error) {
+	value, ok := r.Sysctls[path]
+	if !ok {
+		return "0", nil
+	}
+
+	return value, nil
+}
+
+// Set - records sysctl value
+func (r *Recorder) Set(path string, value string) error {
+	r.Ops = append(r.Ops, fmt.Sprintf("sysctl %s = %s", path, value))
+	r.Sysctls[path] = value
+
+	return nil
+}
+
+// HardwareAddr - fixed MAC address of any interface
+func (r *Recorder) HardwareAddr(dev string) (net.HardwareAddr, error) {
+	return net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}, nil
+}
+
+// Send - records frame as `send <dev> arp|na <address>`
+func (r *Recorder) Send(dev string, frame []byte) error {
+	switch binary.BigEndian.Uint16(frame[12:14]) {
+	case etherTypeARP:
+		r.Ops = append(r.Ops, fmt.Sprintf("send %s arp %s", dev, net.IP(frame[28:32])))
+	case etherTypeIPv6:
+		r.Ops = append(r.Ops, fmt.Sprintf("send %s na %s", dev, net.IP(frame[62:78])))
+	default:
+		r.Ops = append(r.Ops, fmt.Sprintf("send %s %x", dev, frame))
+	}
+
+	return nil
+}
+
+// Sleep - records delay instead of waiting
+func (r *Recorder) Sleep(d time.Duration) {
+	r.Ops = append(r.Ops, fmt.Sprintf("sleep %s", d))
+}
+
+// NewRecordingSystem - returns System backed by Recorder
+func NewRecordingSystem(t *testing.T) (*System, *Recorder) {
+	r := NewRecorder()
+
+	return &System{
+		Runner:  r,
+		Sysctl:  r,
+		Packets: r,
+		Sleep:   r.Sleep,
+		RunDir:  t.TempDir(),
+	}, r
+}
+
+// testHost - identity of host node config is loaded for, keeps tests independent of host running them
+var testHost = HostIdentity{Hostname: "hv1", MachineID: "00000000000000000000000000000001"}
+
+func TestHookGolden(t *testing.T) {
+	cfg, err := GetHostConfig("testdata/qemu-hook.json", testHost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := make([]string, 0, len(cfg.VMs))
+	for name := range cfg.VMs {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for i, name := range names {
+		s, r := NewRecordingSystem(t)
+
+		domCfg := &libvirtxml.Domain{
+			Name: name,
+			UUID: fmt.Sprintf("8b5c4a64-4c44-4c4e-9d2d-4f7a1b7e0a%02d", i+1),
+		}
+
+		hooks := []struct {
+			operation string
+			run       func(*System, *libvirtxml.Domain) error
+		}{
+			{"prepare begin", cfg.PrepareBeginHook},
+			{"started begin", cfg.StartedBeginHook},
+			{"stopped end", cfg.StoppedEndHook},
+			{"release end", cfg.ReleaseEndHook},
+		}
+
+		var got strings.Builder
+
+		for _, hook := range hooks {
+			r.Ops = nil
+
+			err = hook.run(s, domCfg)
+			if err != nil {
+				t.Fatalf("TestCase: %s %s\n Got : %s\n Want: nil", name, hook.operation, err)
+			}
+
+			fmt.Fprintf(&got, "# %s\n%s\n", hook.operation, strings.Join(r.Ops, "\n"))
+		}
+
+		path := filepath.Join("testdata", name+".golden")
+
+		if *update {
+			err = os.WriteFile(path, []byte(got.String()), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		want, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got.String() != string(want) {
+			t.Errorf("TestCase: %s\n Got :\n%s\n Want:\n%s\n", name, got.String(), want)
+		}
+	}
+}
+
+func TestReleaseEndHookWithoutVMConfig(t *testing.T) {
+	s, r := NewRecordingSystem(t)
+
+	released := &libvirtxml.Domain{Name: "vm1", UUID: "8b5c4a64-4c44-4c4e-9d2d-4f7a1b7e0a01"}
+	other := "8b5c4a64-4c44-4c4e-9d2d-4f7a1b7e0a02"
+
+	// state left by `prepare begin` of both domains
+	for dev, users := range map[string][]string{"x-42": {released.UUID, other}, "x-43": {released.UUID}} {
+		for _, user := range users {
+			_, err := s.Refs().Acquire(dev, user)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	_, err := s.Active().Acquire(released.UUID, released.UUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// VM was removed from config while domain was running
+	err = (&Config{}).ReleaseEndHook(s, released)
+	if err != nil {
+		t.Fatalf("TestCase: release end\n Got : %s\n Want: nil", err)
+	}
+
+	want := []string{
+		"ip link show dev x-43",
+		"ip link del x-43 type vxlan",
+	}
+
+	if strings.Join(r.Ops, "\n") != strings.Join(want, "\n") {
+		t.Errorf("TestCase: release end\n Got :\n%s\n Want:\n%s\n", strings.Join(r.Ops, "\n"), strings.Join(want, "\n"))
+	}
+
+	for dev, want := range map[string][]string{"x-42": {other}, "x-43": nil} {
+		users, err := s.Refs().Users(dev)
+		if err != nil || strings.Join(users, ",") != strings.Join(want, ",") {
+			t.Errorf("TestCase: users of %s\n Got : %v, %v\n Want: %v\n", dev, users, err, want)
+		}
+	}
+
+	active, err := s.Active().Devices()
+	if err != nil || len(active) != 0 {
+		t.Errorf("TestCase: active domains\n Got : %v, %v\n Want: none\n", active, err)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+)
+
+// MachineIDPath - path to machine-id of host node
+const MachineIDPath = "/etc/machine-id"
+
+// HostIdentity - identity of host node, matched against host sections
+type HostIdentity struct {
+	Hostname  string
+	MachineID string
+}
+
+// CurrentHost - identity of current host node, missing machine-id is left empty
+func CurrentHost() (HostIdentity, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return HostIdentity{}, fmt.Errorf("host error: %s", err)
+	}
+
+	data, err := os.ReadFile(MachineIDPath)
+	if err != nil && !os.IsNotExist(err) {
+		return HostIdentity{}, fmt.Errorf("host error: %s", err)
+	}
+
+	return HostIdentity{
+		Hostname:  hostname,
+		MachineID: strings.TrimSpace(string(data)),
+	}, nil
+}
+
+// String - `hostname (machine-id)`
+func (id HostIdentity) String() string {
+	if id.MachineID == "" {
+		return id.Hostname
+	}
+
+	return fmt.Sprintf("%s (%s)", id.Hostname, id.MachineID)
+}
+
+// Matches - reports whether host section selects host node, all set selectors must match, section without selectors matches nothing
+func (h *HostSection) Matches(id HostIdentity) bool {
+	if h.Hostname == "" && h.MachineID == "" {
+		return false
+	}
+
+	if h.Hostname != "" {
+		ok, err := path.Match(h.Hostname, id.Hostname)
+		if err != nil || !ok {
+			return false
+		}
+	}
+
+	if h.MachineID != "" && !strings.EqualFold(h.MachineID, id.MachineID) {
+		return false
+	}
+
+	return true
+}
+
+// String - selectors of host section, for error reporting
+func (h *HostSection) String() string {
+	var selectors []string
+
+	if h.Hostname != "" {
+		selectors = append(selectors, fmt.Sprintf("Hostname '%s'", h.Hostname))
+	}
+
+	if h.MachineID != "" {
+		selectors = append(selectors, fmt.Sprintf("MachineID '%s'", h.MachineID))
+	}
+
+	return strings.Join(selectors, " and ")
+}
+
+// SelectHost - selects host section matching host node and merges its VMs, more than one matching section is an error
+func (c *Config) SelectHost(id HostIdentity) error {
+	c.Host = nil
+
+	for i := range c.Hosts {
+		h := &c.Hosts[i]
+		if !h.Matches(id) {
+			continue
+		}
+
+		if c.Host != nil {
+			return fmt.Errorf("host %s matches more than one host section: %s and %s", id, c.Host, h)
+		}
+
+		c.Host = h
+	}
+
+	if c.Host == nil {
+		return nil
+	}
+
+	// host BGP settings override top-level ones
+	if c.Host.BGP != nil {
+		var bgp BGP
+		if c.BGP != nil {
+			bgp = *c.BGP
+		}
+
+		mergeValue(reflect.ValueOf(&bgp).Elem(), reflect.ValueOf(*c.Host.BGP))
+		c.BGP = &bgp
+	}
+
+	for name, vm := range c.Host.VMs {
+		dup, ok := c.VMs[name]
+		if ok {
+			return fmt.Errorf("duplicate VM '%s' defined in '%s' and in host section %s", name, dup.Source, c.Host)
+		}
+
+		c.VMs[name] = vm
+	}
+
+	return nil
+}
+
+// hostLayer - overrides of selected host section as partial VM config, L3 and VxLAN are set only for VMs that define them
+func (c *Config) hostLayer(hasL3, hasVxLAN bool) (VM, bool) {
+	h := c.Host
+	if h == nil || (h.Uplink == nil && h.VxLANLocal == "" && h.TC == nil) {
+		return VM{}, false
+	}
+
+	layer := VM{Interface: &Interface{Uplink: h.Uplink}}
+
+	if hasL3 && h.TC != nil {
+		layer.Interface.L3 = &L3{TC: h.TC}
+	}
+
+	if hasVxLAN && (h.TC != nil || h.VxLANLocal != "") {
+		layer.Interface.VxLAN = &VxLAN{TC: h.TC, Local: h.VxLANLocal}
+	}
+
+	return layer, true
+}
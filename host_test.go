@@ -0,0 +1,209 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGetHostConfig(t *testing.T) {
+	hosts := `"Hosts": [
+		{"Hostname": "hv1", "Uplink": {"Name": "bond-lan"}, "TC": {"Rate": 500, "Burst": 512, "Limit": 20480},
+			"VMs": {"vm2": ` + testVMConfigN(2) + `}},
+		{"Hostname": "hv2*", "MachineID": "fed6b2924c424cf1b9a322f606b4de6d", "Uplink": {"Name": "eth0"}}
+	]`
+
+	vm1 := `{"Interface": {"L3": {"IPv4": ["195.177.118.111"],
+		"Upper": {"Name": "vu-9a0101"}, "Source": {"Name": "vl-9a0101"}, "Target": {"Name": "if-9a0101"}}}}`
+
+	defaults := `"Defaults": {"Interface": {"Uplink": {"Name": "bond-wan"}, "L3": {"TC": {"Rate": 250, "Burst": 256, "Limit": 10240}}}}`
+
+	cases := []struct {
+		caseDescription string
+		config          string
+		id              HostIdentity
+		uplinks         map[string]string
+		rates           map[string]int64
+		err             string
+	}{
+		{
+			caseDescription: "no host section matches, defaults apply",
+			config:          `{` + defaults + `, ` + hosts + `, "VMs": {"vm1": ` + vm1 + `}}`,
+			id:              HostIdentity{Hostname: "hv3"},
+			uplinks:         map[string]string{"vm1": "bond-wan"},
+			rates:           map[string]int64{"vm1": 250},
+		},
+		{
+			caseDescription: "host section overrides defaults and adds VMs",
+			config:          `{` + defaults + `, ` + hosts + `, "VMs": {"vm1": ` + vm1 + `}}`,
+			id:              HostIdentity{Hostname: "hv1"},
+			uplinks:         map[string]string{"vm1": "bond-lan", "vm2": "bond-wan"},
+			rates:           map[string]int64{"vm1": 500, "vm2": 250},
+		},
+		{
+			caseDescription: "all selectors must match",
+			config:          `{` + defaults + `, ` + hosts + `, "VMs": {"vm1": ` + vm1 + `}}`,
+			id:              HostIdentity{Hostname: "hv2-fra", MachineID: "00000000000000000000000000000000"},
+			uplinks:         map[string]string{"vm1": "bond-wan"},
+			rates:           map[string]int64{"vm1": 250},
+		},
+		{
+			caseDescription: "hostname glob and machine-id",
+			config:          `{` + defaults + `, ` + hosts + `, "VMs": {"vm1": ` + vm1 + `}}`,
+			id:              HostIdentity{Hostname: "hv2-fra", MachineID: "FED6B2924C424CF1B9A322F606B4DE6D"},
+			uplinks:         map[string]string{"vm1": "eth0"},
+			rates:           map[string]int64{"vm1": 250},
+		},
+		{
+			caseDescription: "ambiguous host sections",
+			config:          `{"Hosts": [{"Hostname": "hv*"}, {"Hostname": "hv1"}], "VMs": {"vm1": ` + testVMConfig + `}}`,
+			id:              HostIdentity{Hostname: "hv1"},
+			err:             "host hv1 matches more than one host section: Hostname 'hv*' and Hostname 'hv1'",
+		},
+		{
+			caseDescription: "duplicate VM in host section",
+			config:          `{` + hosts + `, "VMs": {"vm2": ` + testVMConfig + `}}`,
+			id:              HostIdentity{Hostname: "hv1"},
+			err:             "duplicate VM 'vm2' defined in",
+		},
+		{
+			caseDescription: "host section without selectors",
+			config:          `{"Hosts": [{"Uplink": {"Name": "eth0"}}], "VMs": {"vm1": ` + testVMConfig + `}}`,
+			id:              HostIdentity{Hostname: "hv1"},
+			err:             "'Hostname' failed on the 'required_without' tag",
+		},
+	}
+
+	for _, testCase := range cases {
+		dir := t.TempDir()
+		writeConfigFiles(t, dir, map[string]string{"qemu-hook.json": testCase.config})
+
+		cfg, err := GetHostConfig(filepath.Join(dir, "qemu-hook.json"), testCase.id)
+		if testCase.err != "" {
+			if err == nil || !strings.Contains(err.Error(), testCase.err) {
+				t.Errorf("TestCase: %s\n Got : %v\n Want: %s\n", testCase.caseDescription, err, testCase.err)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("TestCase: %s\n Got : %s\n Want: nil", testCase.caseDescription, err)
+		}
+
+		uplinks := make(map[string]string)
+		rates := make(map[string]int64)
+
+		for name, vm := range cfg.VMs {
+			uplinks[name] = vm.Interface.Uplink.Name
+			rates[name] = vm.Interface.L3.TC.Rate
+		}
+
+		if !reflect.DeepEqual(uplinks, testCase.uplinks) || !reflect.DeepEqual(rates, testCase.rates) {
+			t.Errorf("TestCase: %s\n Got : %v, %v\n Want: %v, %v\n", testCase.caseDescription, uplinks, rates, testCase.uplinks, testCase.rates)
+		}
+	}
+}
+
+func TestHostLayer(t *testing.T) {
+	cfg := &Config{
+		Host: &HostSection{Hostname: "hv1", Uplink: &Iface{"bond-lan"}, VxLANLocal: "10.0.0.1", TC: &TC{Rate: 500}},
+		Profiles: map[string]VM{
+			"lan": {Interface: &Interface{Uplink: &Iface{"eth0"}, VxLAN: &VxLAN{Local: "10.0.0.9", TC: &TC{Rate: 100, Burst: 128}}}},
+		},
+	}
+
+	cases := []struct {
+		caseDescription string
+		vm              VM
+		want            VM
+	}{
+		{
+			caseDescription: "L3 only VM gets no VxLAN",
+			vm:              VM{Interface: &Interface{L3: &L3{IPv4: []string{"195.177.118.111"}}}},
+			want:            VM{Interface: &Interface{Uplink: &Iface{"bond-lan"}, L3: &L3{IPv4: []string{"195.177.118.111"}, TC: &TC{Rate: 500}}}},
+		},
+		{
+			caseDescription: "VxLAN only VM gets no L3",
+			vm:              VM{Interface: &Interface{VxLAN: &VxLAN{VNI: 42}}},
+			want:            VM{Interface: &Interface{Uplink: &Iface{"bond-lan"}, VxLAN: &VxLAN{VNI: 42, Local: "10.0.0.1", TC: &TC{Rate: 500}}}},
+		},
+		{
+			caseDescription: "VM value wins over host section",
+			vm:              VM{Interface: &Interface{VxLAN: &VxLAN{VNI: 42, Local: "10.0.0.2"}}},
+			want:            VM{Interface: &Interface{Uplink: &Iface{"bond-lan"}, VxLAN: &VxLAN{VNI: 42, Local: "10.0.0.2", TC: &TC{Rate: 500}}}},
+		},
+		{
+			caseDescription: "host section wins over profile",
+			vm:              VM{Profile: "lan", Interface: &Interface{VxLAN: &VxLAN{VNI: 42}}},
+			want:            VM{Profile: "lan", Interface: &Interface{Uplink: &Iface{"bond-lan"}, VxLAN: &VxLAN{VNI: 42, Local: "10.0.0.1", TC: &TC{Rate: 500, Burst: 128}}}},
+		},
+	}
+
+	for _, testCase := range cases {
+		got, err := cfg.ResolveVM(testCase.vm)
+		if err != nil || !reflect.DeepEqual(got, testCase.want) {
+			t.Errorf("TestCase: %s\n Got : %+v, %v\n Want: %+v\n", testCase.caseDescription, got, err, testCase.want)
+		}
+	}
+}
+
+func TestHostBGP(t *testing.T) {
+	bgp := `"BGP": {"ASN": 65001, "RouterID": "195.177.118.1", "Peers": [{"Address": "195.177.118.254", "ASN": 65000}]}`
+	hosts := `"Hosts": [{"Hostname": "hv2", "BGP": {"RouterID": "195.177.118.2", "NextHop4": "195.177.118.2"}}]`
+
+	cases := []struct {
+		caseDescription string
+		config          string
+		id              HostIdentity
+		want            *BGP
+		err             string
+	}{
+		{
+			caseDescription: "no BGP section",
+			config:          `{"VMs": {"vm1": ` + testVMConfig + `}}`,
+			id:              HostIdentity{Hostname: "hv1"},
+		},
+		{
+			caseDescription: "no host section matches",
+			config:          `{` + bgp + `, ` + hosts + `, "VMs": {"vm1": ` + testVMConfig + `}}`,
+			id:              HostIdentity{Hostname: "hv1"},
+			want:            &BGP{ASN: 65001, RouterID: "195.177.118.1", Peers: []BGPPeer{{Address: "195.177.118.254", ASN: 65000}}},
+		},
+		{
+			caseDescription: "host section overrides fields",
+			config:          `{` + bgp + `, ` + hosts + `, "VMs": {"vm1": ` + testVMConfig + `}}`,
+			id:              HostIdentity{Hostname: "hv2"},
+			want:            &BGP{ASN: 65001, RouterID: "195.177.118.2", NextHop4: "195.177.118.2", Peers: []BGPPeer{{Address: "195.177.118.254", ASN: 65000}}},
+		},
+		{
+			caseDescription: "host section alone is incomplete",
+			config:          `{` + hosts + `, "VMs": {"vm1": ` + testVMConfig + `}}`,
+			id:              HostIdentity{Hostname: "hv2"},
+			err:             "'ASN' failed on the 'required' tag",
+		},
+	}
+
+	for _, testCase := range cases {
+		dir := t.TempDir()
+		writeConfigFiles(t, dir, map[string]string{"qemu-hook.json": testCase.config})
+
+		cfg, err := GetHostConfig(filepath.Join(dir, "qemu-hook.json"), testCase.id)
+		if testCase.err != "" {
+			if err == nil || !strings.Contains(err.Error(), testCase.err) {
+				t.Errorf("TestCase: %s\n Got : %v\n Want: %s\n", testCase.caseDescription, err, testCase.err)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("TestCase: %s\n Got : %s\n Want: nil", testCase.caseDescription, err)
+		}
+
+		if !reflect.DeepEqual(cfg.BGP, testCase.want) {
+			t.Errorf("TestCase: %s\n Got : %+v\n Want: %+v\n", testCase.caseDescription, cfg.BGP, testCase.want)
+		}
+	}
+}
@@ -1,67 +1,62 @@
 package main
 
 import (
-	"log"
+	"io"
 	"os"
 
 	validator "gopkg.in/go-playground/validator.v9"
 )
 
 var (
-	// custom logger
-	Logger *log.Logger
+	// custom structured logger, logs to stderr until log sink is opened
+	Logger = NewLogger(os.Stderr, nil)
 
-	// Fd is a logfile declared global to be closed in main()
-	Fd *os.File
+	// LogSink is a log sink declared global to be closed in main()
+	LogSink io.Closer = io.NopCloser(os.Stderr)
 
 	// Validate defines validator object
 	Validate *validator.Validate
 
 	// main hook config
 	c *Config
+
+	// Sys defines external dependencies of hook functions on host node
+	Sys = NewSystem()
 )
 
 func init() {
 	var err error
 
-	// flag for opening LogFile
-	var flag int
-
-	_, err = os.Stat(LogFilePath)
-
-	// if logfile does not exist - will also create the file
-	switch os.IsNotExist(err) {
-	case true:
-		flag = os.O_WRONLY | os.O_CREATE | os.O_APPEND
-	case false:
-		flag = os.O_WRONLY | os.O_APPEND
-	}
-
-	// create/open log file
-	Fd, err = os.OpenFile(LogFilePath, flag, 0666)
-	if err != nil {
-		log.Fatalf("error opening log file: %v", err)
-	}
-
-	// configure logger
-	Logger = log.New(Fd, "", log.Ldate|log.Ltime|log.Lshortfile)
-
 	// initialize validator object
 	Validate = validator.New()
 
 	// register custom validation functions
 	err = Validate.RegisterValidation("iface", IsValidInterfaceName)
 	if err != nil {
-		Logger.Fatalf("validator error: %v", err)
+		Logger.Error("validator error", "error", err)
+		os.Exit(1)
 	}
 	err = Validate.RegisterValidation("notGW6", IsNotIPv6NetworkAddress)
 	if err != nil {
-		Logger.Fatalf("validator error: %v", err)
+		Logger.Error("validator error", "error", err)
+		os.Exit(1)
 	}
-
-	// get config data
-	c, err = GetConfig(ConfigPath)
+	err = Validate.RegisterValidation("ifaceTemplate", IsValidInterfaceNameTemplate)
+	if err != nil {
+		Logger.Error("validator error", "error", err)
+		os.Exit(1)
+	}
+	err = Validate.RegisterValidation("glob", IsValidGlob)
 	if err != nil {
-		Logger.Fatal(err)
+		Logger.Error("validator error", "error", err)
+		os.Exit(1)
 	}
+	err = Validate.RegisterValidation("regexp", IsValidRegexp)
+	if err != nil {
+		Logger.Error("validator error", "error", err)
+		os.Exit(1)
+	}
+
+	// register custom struct validation functions
+	Validate.RegisterStructValidation(ValidateL3Routes, L3{})
 }
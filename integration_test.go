@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	libvirtxml "github.com/libvirt/libvirt-go-xml"
+)
+
+// NetnsRunner - Runner executing commands inside network namespace
+type NetnsRunner struct {
+	Netns string
+}
+
+// Run - runs command inside network namespace
+func (r NetnsRunner) Run(name string, arg ...string) RunCommandOutput {
+	return RunCommand("ip", append([]string{"netns", "exec", r.Netns, name}, arg...)...)
+}
+
+// NetnsSysctl - SysctlStore backed by `/proc/sys` files of network namespace
+type NetnsSysctl struct {
+	Netns string
+}
+
+// Get - reads value from sysctl file inside network namespace
+func (s NetnsSysctl) Get(path string) (string, error) {
+	cmd := NetnsRunner(s).Run("cat", path)
+	if cmd.ReturnCode != 0 {
+		return "", cmd.Error("netns sysctl error:")
+	}
+
+	return strings.TrimSpace(string(cmd.CombinedOutput)), nil
+}
+
+// Set - writes value to sysctl file inside network namespace
+func (s NetnsSysctl) Set(path string, value string) error {
+	cmd := NetnsRunner(s).Run("sh", "-c", fmt.Sprintf("echo '%s' > '%s'", value, path))
+	if cmd.ReturnCode != 0 {
+		return cmd.Error("netns sysctl error:")
+	}
+
+	return nil
+}
+
+// NewNetnsSystem - creates throwaway network namespace, returns System operating inside it
+func NewNetnsSystem(t *testing.T) *System {
+	t.Helper()
+
+	if os.Geteuid() != 0 {
+		t.Skip("integration test requires CAP_NET_ADMIN")
+	}
+
+	netns := fmt.Sprintf("qemu-hook-test-%d", os.Getpid())
+
+	cmd := RunCommand("ip", "netns", "add", netns)
+	if cmd.ReturnCode != 0 {
+		t.Skipf("integration test requires CAP_NET_ADMIN: %s", cmd.Error("netns error:"))
+	}
+
+	t.Cleanup(func() {
+		RunCommand("ip", "netns", "del", netns)
+	})
+
+	return &System{
+		Runner: NetnsRunner{Netns: netns},
+		Sysctl: NetnsSysctl{Netns: netns},
+		RunDir: t.TempDir(),
+	}
+}
+
+// addStandIn - creates dummy link standing in for uplink or tap, falls back to bridge when kernel lacks dummy
+func addStandIn(t *testing.T, s *System, name string) {
+	t.Helper()
+
+	for _, kind := range []string{"dummy", "bridge"} {
+		cmd := s.Runner.Run("ip", "link", "add", "name", name, "type", kind)
+		if cmd.ReturnCode != 0 {
+			continue
+		}
+
+		cmd = s.Runner.Run("ip", "link", "set", "dev", name, "up")
+		if cmd.ReturnCode != 0 {
+			t.Fatal(cmd.Error("netns error:"))
+		}
+
+		return
+	}
+
+	t.Skipf("integration test requires dummy or bridge link support")
+}
+
+// assertOutput - runs command inside network namespace and checks that its output contains every wanted string
+func assertOutput(t *testing.T, s *System, want []string, name string, arg ...string) {
+	t.Helper()
+
+	cmd := s.Runner.Run(name, arg...)
+
+	for _, w := range want {
+		if !strings.Contains(string(cmd.CombinedOutput), w) {
+			t.Errorf("Command: %s\n Got : %s\n Want: %s\n", cmd.Command, cmd.CombinedOutput, w)
+		}
+	}
+}
+
+// assertSysctl - checks sysctl value inside network namespace
+func assertSysctl(t *testing.T, s *System, path string, want string) {
+	t.Helper()
+
+	got, err := s.Sysctl.Get(path)
+	if err != nil || got != want {
+		t.Errorf("Sysctl: %s\n Got : %s, %v\n Want: %s\n", path, got, err, want)
+	}
+}
+
+func TestHookIntegration(t *testing.T) {
+	s := NewNetnsSystem(t)
+
+	cfg := &Config{
+		VMs: map[string]VM{
+			"vm1": {
+				Interface: &Interface{
+					VxLAN: &VxLAN{
+						VNI:    42,
+						Source: &Iface{"x-42"},
+						Target: &Iface{"vx-9a0101"},
+						TC:     &TC{Rate: 250, Burst: 256, Limit: 10240},
+					},
+					L3: &L3{
+						IPv4:   []string{"195.177.118.111"},
+						IPv6:   []string{"2a02:2278:100:1::1"},
+						Upper:  &Iface{"vu-9a0101"},
+						Source: &Iface{"vl-9a0101"},
+						Target: &Iface{"if-9a0101"},
+						TC:     &TC{Rate: 250, Burst: 256, Limit: 10240},
+					},
+					Uplink: &Iface{"bond-wan"},
+				},
+			},
+		},
+	}
+
+	domCfg := &libvirtxml.Domain{
+		Name: "vm1",
+		UUID: "8b5c4a64-4c44-4c4e-9d2d-4f7a1b7e0a01",
+	}
+
+	addStandIn(t, s, "bond-wan")
+
+	ok := t.Run("prepare begin", func(t *testing.T) {
+		err := cfg.PrepareBeginHook(s, domCfg)
+		if err != nil {
+			t.Fatalf("Got : %s\n Want: nil", err)
+		}
+
+		assertOutput(t, s, []string{"x-42", "vxlan id 42", "alias qemu-hook:shared"}, "ip", "-d", "link", "show", "dev", "x-42")
+		assertOutput(t, s, []string{"vu-9a0101", "veth", "alias qemu-hook:8b5c4a64-4c44-4c4e-9d2d-4f7a1b7e0a01:vm1"}, "ip", "-d", "link", "show", "dev", "vu-9a0101")
+		assertOutput(t, s, []string{"vl-9a0101", "veth"}, "ip", "-d", "link", "show", "dev", "vl-9a0101")
+		assertOutput(t, s, []string{"195.177.118.111 dev vu-9a0101 proto 220"}, "ip", "-4", "route", "show")
+		assertOutput(t, s, []string{"2a02:2278:100:1::1 dev vu-9a0101 proto 220"}, "ip", "-6", "route", "show")
+		assertOutput(t, s, []string{"2a02:2278:100:1::/64", "nodad", "noprefixroute"}, "ip", "-6", "addr", "show", "dev", "vu-9a0101")
+
+		assertSysctl(t, s, "/proc/sys/net/ipv4/conf/bond-wan/forwarding", "1")
+		assertSysctl(t, s, "/proc/sys/net/ipv6/conf/all/forwarding", "1")
+		assertSysctl(t, s, "/proc/sys/net/ipv4/conf/vu-9a0101/proxy_arp", "1")
+		assertSysctl(t, s, "/proc/sys/net/ipv6/conf/vu-9a0101/proxy_ndp", "1")
+	})
+
+	// later steps run on state left by earlier ones
+	if !ok {
+		t.FailNow()
+	}
+
+	// libvirt creates taps between `prepare begin` and `started begin`
+	addStandIn(t, s, "if-9a0101")
+	addStandIn(t, s, "vx-9a0101")
+
+	ok = t.Run("started begin", func(t *testing.T) {
+		// probe kernel for qdiscs used by hook
+		cmd := s.Runner.Run("tc", "qdisc", "add", "dev", "lo", "root", "fq_codel")
+		if cmd.ReturnCode != 0 {
+			t.Skipf("kernel lacks fq_codel qdisc: %s", cmd.CombinedOutput)
+		}
+
+		s.Runner.Run("tc", "qdisc", "del", "dev", "lo", "root")
+
+		err := cfg.StartedBeginHook(s, domCfg)
+		if err != nil {
+			t.Fatalf("Got : %s\n Want: nil", err)
+		}
+
+		for _, dev := range []string{"if-9a0101", "vx-9a0101"} {
+			assertOutput(t, s, []string{"qdisc tbf 4843: root", "rate 250Mbit", "qdisc fq_codel 10: parent 4843:1"}, "tc", "qdisc", "show", "dev", dev)
+		}
+	})
+
+	// later steps run on state left by earlier ones
+	if !ok {
+		t.FailNow()
+	}
+
+	ok = t.Run("stopped end", func(t *testing.T) {
+		err := cfg.StoppedEndHook(s, domCfg)
+		if err != nil {
+			t.Fatalf("Got : %s\n Want: nil", err)
+		}
+
+		if s.IsInterfaceExists("vu-9a0101") || s.IsInterfaceExists("vl-9a0101") {
+			t.Errorf("Got : veth pair exists\n Want: veth pair removed")
+		}
+
+		// routes are removed together with veth pair
+		cmd := s.Runner.Run("ip", "-4", "route", "show", "proto", HookRouteProtocol)
+		if len(strings.TrimSpace(string(cmd.CombinedOutput))) != 0 {
+			t.Errorf("Got : %s\n Want: no hook routes", cmd.CombinedOutput)
+		}
+	})
+
+	// later steps run on state left by earlier ones
+	if !ok {
+		t.FailNow()
+	}
+
+	t.Run("release end", func(t *testing.T) {
+		err := cfg.ReleaseEndHook(s, domCfg)
+		if err != nil {
+			t.Fatalf("Got : %s\n Want: nil", err)
+		}
+
+		if s.IsInterfaceExists("x-42") {
+			t.Errorf("Got : shared VxLAN exists\n Want: shared VxLAN removed after last user")
+		}
+	})
+}
@@ -9,3 +9,13 @@ func GetNetworkAddressFromIPv6(ip string) string {
 	// mask corresponds to a /64 subnet for IPv6.
 	return net.ParseIP(ip).Mask(net.CIDRMask(64, 128)).String()
 }
+
+// GetPrefixAddress - network address of prefix without prefix length, empty for invalid prefix
+func GetPrefixAddress(prefix string) string {
+	_, network, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return ""
+	}
+
+	return network.IP.String()
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// lockPollInterval - delay between attempts to take lock held by concurrent hook invocation
+const lockPollInterval = 50 * time.Millisecond
+
+// FileLock - exclusive advisory lock (flock) on file, shared between hook processes
+type FileLock struct {
+	Path string
+	fd   *os.File
+}
+
+// LockPath - path to lock file for named resource inside directory
+func LockPath(dir, name string) string {
+	// keep lock name usable as file name
+	name = strings.NewReplacer("/", "_", ":", "_").Replace(SanitizeInput(name))
+
+	return filepath.Join(filepath.Clean(dir), "locks", name+".lock")
+}
+
+// AcquireLock - takes exclusive lock on named resource, waits up to timeout for concurrent hook invocation to release it, or until context is done
+func AcquireLock(ctx context.Context, dir, name string, timeout time.Duration) (*FileLock, error) {
+	return acquireLock(ctx, dir, name, syscall.LOCK_EX, timeout)
+}
+
+// AcquireSharedLock - takes shared lock on named resource, any number of shared holders exclude exclusive one
+func AcquireSharedLock(ctx context.Context, dir, name string, timeout time.Duration) (*FileLock, error) {
+	return acquireLock(ctx, dir, name, syscall.LOCK_SH, timeout)
+}
+
+// acquireLock - takes lock of flock mode on named resource
+func acquireLock(ctx context.Context, dir, name string, how int, timeout time.Duration) (*FileLock, error) {
+	// prefix for errors logging
+	const errPrefix = "lock error:"
+
+	path := LockPath(dir, name)
+
+	// create locks directory
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s", errPrefix, err)
+	}
+
+	// open lock file, lock file is never removed, to avoid races with concurrent lockers
+	fd, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s", errPrefix, err)
+	}
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for {
+		err = syscall.Flock(int(fd.Fd()), how|syscall.LOCK_NB)
+		if err == nil {
+			return &FileLock{Path: path, fd: fd}, nil
+		}
+
+		if err != syscall.EWOULDBLOCK && err != syscall.EINTR {
+			_ = fd.Close()
+
+			return nil, fmt.Errorf("%s '%s': %s", errPrefix, path, err)
+		}
+
+		// whichever comes first: lock timeout or total hook timeout
+		select {
+		case <-deadline.C:
+			_ = fd.Close()
+
+			return nil, fmt.Errorf("%s '%s': timeout after %s waiting for concurrent hook invocation", errPrefix, path, timeout)
+		case <-ctx.Done():
+			_ = fd.Close()
+
+			return nil, fmt.Errorf("%s '%s': %w while waiting for concurrent hook invocation", errPrefix, path, ErrHookTimeout)
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+// Release - releases lock
+func (l *FileLock) Release() error {
+	err := syscall.Flock(int(l.fd.Fd()), syscall.LOCK_UN)
+	if err != nil {
+		_ = l.fd.Close()
+
+		return fmt.Errorf("lock error: '%s': %s", l.Path, err)
+	}
+
+	return l.fd.Close()
+}
+
+// Lock - takes exclusive lock on named resource, returns function to release it
+func (s *System) Lock(name string) (func(), error) {
+	return s.lock(AcquireLock, name)
+}
+
+// lock - takes lock with acquire function, returns function to release it
+func (s *System) lock(acquire func(ctx context.Context, dir, name string, timeout time.Duration) (*FileLock, error), name string) (func(), error) {
+	lock, err := acquire(HookContext, s.RunDir, name, LockTimeout)
+	if err != nil {
+		s.logger().Error(err.Error())
+
+		return nil, err
+	}
+
+	return func() {
+		err := lock.Release()
+		if err != nil {
+			s.logger().Error(err.Error())
+		}
+	}, nil
+}
+
+// GCLockName - lock held exclusively by `gc` and shared by hook invocations, so gc never sees half-configured domain
+const GCLockName = "gc"
+
+// LockDomain - takes shared gc lock and exclusive lock of domain, returns function to release both
+func (s *System) LockDomain(uuid string) (func(), error) {
+	unlockGC, err := s.lock(AcquireSharedLock, GCLockName)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock, err := s.Lock("domain:" + uuid)
+	if err != nil {
+		unlockGC()
+
+		return nil, err
+	}
+
+	return func() {
+		unlock()
+		unlockGC()
+	}, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAcquireLock(t *testing.T) {
+	dir := t.TempDir()
+
+	lock, err := AcquireLock(context.Background(), dir, "link:x-42", time.Second)
+	if err != nil {
+		t.Fatalf("Got : %s\n Want: nil", err)
+	}
+
+	// concurrent holder must time out
+	_, err = AcquireLock(context.Background(), dir, "link:x-42", 100*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "timeout") {
+		t.Errorf("Got : %v\n Want: timeout error", err)
+	}
+
+	// other resource is not blocked
+	other, err := AcquireLock(context.Background(), dir, "link:x-43", 100*time.Millisecond)
+	if err != nil {
+		t.Errorf("Got : %s\n Want: nil", err)
+	} else {
+		_ = other.Release()
+	}
+
+	err = lock.Release()
+	if err != nil {
+		t.Fatalf("Got : %s\n Want: nil", err)
+	}
+
+	// released lock is free again
+	lock, err = AcquireLock(context.Background(), dir, "link:x-42", 100*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Got : %s\n Want: nil", err)
+	}
+
+	_ = lock.Release()
+}
+
+func TestAcquireSharedLock(t *testing.T) {
+	dir := t.TempDir()
+
+	// hook invocations share gc lock
+	first, err := AcquireSharedLock(context.Background(), dir, GCLockName, time.Second)
+	if err != nil {
+		t.Fatalf("Got : %s\n Want: nil", err)
+	}
+
+	second, err := AcquireSharedLock(context.Background(), dir, GCLockName, 100*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Got : %s\n Want: nil", err)
+	}
+
+	// gc waits for every hook invocation
+	_, err = AcquireLock(context.Background(), dir, GCLockName, 100*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "timeout") {
+		t.Errorf("Got : %v\n Want: timeout error", err)
+	}
+
+	_ = first.Release()
+	_ = second.Release()
+
+	gc, err := AcquireLock(context.Background(), dir, GCLockName, 100*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Got : %s\n Want: nil", err)
+	}
+
+	// hook invocations wait for gc
+	_, err = AcquireSharedLock(context.Background(), dir, GCLockName, 100*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "timeout") {
+		t.Errorf("Got : %v\n Want: timeout error", err)
+	}
+
+	_ = gc.Release()
+}
+
+func TestAcquireLockHookTimeout(t *testing.T) {
+	dir := t.TempDir()
+
+	lock, err := AcquireLock(context.Background(), dir, "domain:x", time.Second)
+	if err != nil {
+		t.Fatalf("Got : %s\n Want: nil", err)
+	}
+	defer func() { _ = lock.Release() }()
+
+	// total hook timeout is shorter than lock timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+
+	_, err = AcquireLock(ctx, dir, "domain:x", time.Minute)
+	if !errors.Is(err, ErrHookTimeout) {
+		t.Errorf("Got : %v\n Want: %s", err, ErrHookTimeout)
+	}
+
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("Got : waited %s\n Want: wait bounded by hook timeout", elapsed)
+	}
+}
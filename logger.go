@@ -0,0 +1,48 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// NewLogger - returns structured logger writing to w, configured by optional log config
+func NewLogger(w io.Writer, cfg *Log) *slog.Logger {
+	if cfg == nil {
+		cfg = new(Log)
+	}
+
+	opts := &slog.HandlerOptions{
+		Level: cfg.SlogLevel(),
+	}
+
+	if strings.EqualFold(cfg.Format, "json") {
+		return slog.New(slog.NewJSONHandler(w, opts))
+	}
+
+	return slog.New(slog.NewTextHandler(w, opts))
+}
+
+// SlogLevel - configured log level, info by default
+func (l *Log) SlogLevel() slog.Level {
+	var level slog.Level
+
+	// empty or invalid level stays at info, config validation reports invalid level
+	_ = level.UnmarshalText([]byte(l.Level))
+
+	return level
+}
+
+// NewInvocationID - returns random ID, used to correlate log lines of single hook invocation
+func NewInvocationID() string {
+	b := make([]byte, 8)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "unknown"
+	}
+
+	return hex.EncodeToString(b)
+}
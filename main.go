@@ -7,47 +7,87 @@ import (
 )
 
 func main() {
-	// closing logfile
-	defer func(fd *os.File) {
-		err := fd.Close()
+	// closing log sink, as opened by Bootstrap
+	defer func() {
+		err := LogSink.Close()
 		if err != nil {
-			log.Fatalf("error closing log file: %v", err)
+			log.Fatalf("error closing log sink: %v", err)
 		}
-	}(Fd)
+	}()
 
 	// GracefullExit logs error to defined logger and exits gracefully
 	GracefullExit := func(err error) {
 		// log hook exit
 		if err != nil {
-			Logger.Println("graceful exit for libvirt, but errors occurred")
+			Logger.Warn("graceful exit for libvirt, but errors occurred")
 		} else {
-			Logger.Println("graceful exit for libvirt, no errors occurred")
+			Logger.Info("graceful exit for libvirt, no errors occurred")
 		}
 
 		// exit with 0 code, else libvirt daemon will fail to start VM
 		os.Exit(0)
 	}
 
+	// resolve paths to config and log file
+	paths, pathsErr := ResolvePaths(SidecarPath(), os.Getenv)
+
+	// run operator command, when not invoked by libvirt
+	if !IsHookInvocation(os.Args) {
+		if pathsErr != nil {
+			Logger.Error(pathsErr.Error())
+			os.Exit(1)
+		}
+
+		if len(os.Args) < 2 {
+			PrintUsage()
+			os.Exit(2)
+		}
+
+		os.Exit(RunCLI(os.Args, paths))
+	}
+
+	// hook must not fail VM operations on broken side-car file, default paths are used instead
+	if pathsErr != nil {
+		paths = DefaultPaths()
+	}
+
+	// open default log sink, config is loaded only by operations that need it
+	OpenLog(paths, nil)
+
+	if pathsErr != nil {
+		Logger.Error(pathsErr.Error(), "config", paths.Config, "log", paths.Log)
+	}
+
+	// correlate log lines of this invocation: `qemu vm1 prepare begin -`
+	WithLogContext(
+		"invocation", NewInvocationID(),
+		"domain", os.Args[1],
+		"operation", os.Args[2],
+		"sub_operation", os.Args[3],
+	)
+
 	// get Libvirt Domain XML as object
 	domCfg, err := GetDomainXML(os.Stdin)
 	if err != nil {
 		GracefullExit(err)
 	}
 
+	WithLogContext("uuid", domCfg.UUID)
+
 	switch os.Args[2] {
 	// switch on: `qemu vm1 {prepare} begin -`
 	case "prepare":
 		// switch on: `qemu vm1 prepare {begin} -`
 		if strings.EqualFold(os.Args[3], "begin") {
-			Logger.Printf("hook: '%s' prepare, begin -\n", os.Args[1])
+			Logger.Info("hook")
 
-			GracefullExit(c.PrepareBeginHook(domCfg))
+			GracefullExit(RunHook(paths, (*Config).PrepareBeginHook, domCfg))
 		}
 	// switch on: `qemu vm1 {start} begin -`
 	case "start":
 		// switch on: `qemu vm1 start {begin} -`
 		if strings.EqualFold(os.Args[3], "begin") {
-			Logger.Printf("hook: '%s' start, begin -\n", os.Args[1])
+			Logger.Info("hook")
 
 			GracefullExit(nil)
 		}
@@ -55,31 +95,31 @@ func main() {
 	case "started":
 		// switch on: `qemu vm1 started {begin} -`
 		if strings.EqualFold(os.Args[3], "begin") {
-			Logger.Printf("hook: '%s' started, begin -\n", os.Args[1])
+			Logger.Info("hook")
 
-			GracefullExit(c.StartedBeginHook(domCfg))
+			GracefullExit(RunHook(paths, (*Config).StartedBeginHook, domCfg))
 		}
 	// switch on: `qemu vm1 {stopped} end -`
 	case "stopped":
 		// switch on: `qemu vm1 stopped {end} -`
 		if strings.EqualFold(os.Args[3], "end") {
-			Logger.Printf("hook: '%s' stopped, end -\n", os.Args[1])
+			Logger.Info("hook")
 
-			GracefullExit(c.StoppedEndHook(domCfg))
+			GracefullExit(RunHook(paths, (*Config).StoppedEndHook, domCfg))
 		}
 	// switch on: `qemu vm1 {release} end -`
 	case "release":
 		// switch on: `qemu vm1 release {end} -`
 		if strings.EqualFold(os.Args[3], "end") {
-			Logger.Printf("hook: '%s' release, end -\n", os.Args[1])
+			Logger.Info("hook")
 
-			GracefullExit(nil)
+			GracefullExit(RunHook(paths, (*Config).ReleaseEndHook, domCfg))
 		}
 	// switch on: `qemu vm1 {migrate} begin -`
 	case "migrate":
 		// switch on: `qemu vm1 migrate {begin} -`
 		if strings.EqualFold(os.Args[3], "begin") {
-			Logger.Printf("hook: '%s' migrate, begin -\n", os.Args[1])
+			Logger.Info("hook")
 
 			GracefullExit(nil)
 		}
@@ -87,7 +127,7 @@ func main() {
 	case "restore":
 		// switch on: `qemu vm1 restore {begin} -`
 		if strings.EqualFold(os.Args[3], "begin") {
-			Logger.Printf("hook: '%s' restore, begin -\n", os.Args[1])
+			Logger.Info("hook")
 
 			GracefullExit(nil)
 		}
@@ -95,7 +135,7 @@ func main() {
 	case "reconnect":
 		// switch on: `qemu vm1 reconnect {begin} -`
 		if strings.EqualFold(os.Args[3], "begin") {
-			Logger.Printf("hook: '%s' reconnect, begin -\n", os.Args[1])
+			Logger.Info("hook")
 
 			GracefullExit(nil)
 		}
@@ -103,7 +143,7 @@ func main() {
 	case "attach":
 		// switch on: `qemu vm1 attach {begin} -`
 		if strings.EqualFold(os.Args[3], "begin") {
-			Logger.Printf("hook: '%s' attach, begin -\n", os.Args[1])
+			Logger.Info("hook")
 
 			GracefullExit(nil)
 		}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"strings"
+)
+
+// Marker - ownership tag set as interface alias (ifalias) on every link created by hook
+type Marker struct {
+	// domain UUID, empty for resources shared between VMs
+	UUID string
+	// domain Name, empty for resources shared between VMs
+	Name string
+}
+
+// markerShared - owner part of marker for resources shared between VMs
+const markerShared = "shared"
+
+// NewMarker - returns marker for resources owned by specified domain
+func NewMarker(uuid, name string) Marker {
+	return Marker{
+		UUID: SanitizeInput(uuid),
+		Name: SanitizeInput(name),
+	}
+}
+
+// IsShared - reports whether marker belongs to resource shared between VMs
+func (m Marker) IsShared() bool {
+	return m.UUID == "" && m.Name == ""
+}
+
+// String - marker representation stored in interface alias: `qemu-hook:<uuid>:<name>` or `qemu-hook:shared`
+func (m Marker) String() string {
+	if m.IsShared() {
+		return HookMarker + ":" + markerShared
+	}
+
+	return HookMarker + ":" + m.UUID + ":" + m.Name
+}
+
+// ParseMarker - parses interface alias, reports false for aliases not set by hook
+func ParseMarker(alias string) (Marker, bool) {
+	parts := strings.SplitN(SanitizeInput(alias), ":", 3)
+	if len(parts) < 2 || parts[0] != HookMarker {
+		return Marker{}, false
+	}
+
+	// shared resource
+	if len(parts) == 2 {
+		if parts[1] != markerShared {
+			return Marker{}, false
+		}
+
+		return Marker{}, true
+	}
+
+	return Marker{UUID: parts[1], Name: parts[2]}, true
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	libvirtxml "github.com/libvirt/libvirt-go-xml"
+)
+
+// ErrVMNotFound - domain is not managed by hook, no VM config selects it
+var ErrVMNotFound = errors.New("no VM found in config")
+
+// MatchTiers - selector tiers in priority order, VM selector belongs to tier of its most specific field
+var MatchTiers = []string{"MAC", "Label", "Title", "Name"}
+
+// Tier - index of selector tier in MatchTiers
+func (m *Match) Tier() int {
+	switch {
+	case m.MAC != "":
+		return 0
+	case m.Label != "":
+		return 1
+	case m.Title != "":
+		return 2
+	default:
+		return 3
+	}
+}
+
+// IsEmpty - reports whether selector has no fields, empty selector matches nothing
+func (m *Match) IsEmpty() bool {
+	return *m == Match{}
+}
+
+// Matches - reports whether domain is selected, all set fields must match
+func (m *Match) Matches(domCfg *libvirtxml.Domain, labels []string) bool {
+	if m.IsEmpty() {
+		return false
+	}
+
+	if m.Name != "" {
+		ok, err := path.Match(m.Name, domCfg.Name)
+		if err != nil || !ok {
+			return false
+		}
+	}
+
+	if m.NameRegex != "" {
+		re, err := regexp.Compile("^(?:" + m.NameRegex + ")$")
+		if err != nil || !re.MatchString(domCfg.Name) {
+			return false
+		}
+	}
+
+	if m.Title != "" {
+		ok, err := path.Match(m.Title, domCfg.Title)
+		if err != nil || !ok {
+			return false
+		}
+	}
+
+	if m.MAC != "" && !hasDomainMAC(domCfg, m.MAC) {
+		return false
+	}
+
+	if m.Label != "" && !hasLabel(labels, m.Label) {
+		return false
+	}
+
+	return true
+}
+
+// hasDomainMAC - reports whether any domain interface has MAC address
+func hasDomainMAC(domCfg *libvirtxml.Domain, mac string) bool {
+	if domCfg.Devices == nil {
+		return false
+	}
+
+	for _, iface := range domCfg.Devices.Interfaces {
+		if iface.MAC != nil && isSameMAC(mac, iface.MAC.Address) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasLabel - reports whether label is in list
+func hasLabel(labels []string, label string) bool {
+	for _, l := range labels {
+		if l == label {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DomainLabels - labels in hook namespace of domain metadata:
+//
+//	<metadata>
+//	  <qemu-hook:labels xmlns:qemu-hook="https://github.com/s3rj1k/go-libvirt-custom-hook">
+//	    <qemu-hook:label>ci-runner</qemu-hook:label>
+//	  </qemu-hook:labels>
+//	</metadata>
+func DomainLabels(domCfg *libvirtxml.Domain) ([]string, error) {
+	if domCfg.Metadata == nil {
+		return nil, nil
+	}
+
+	var labels []string
+
+	dec := xml.NewDecoder(strings.NewReader(domCfg.Metadata.XML))
+
+	for {
+		token, err := dec.Token()
+		if err == io.EOF {
+			return labels, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("domain metadata error: %s", err)
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Space != HookMetadataNamespace || start.Name.Local != "label" {
+			continue
+		}
+
+		var label string
+
+		err = dec.DecodeElement(&label, &start)
+		if err != nil {
+			return nil, fmt.Errorf("domain metadata error: %s", err)
+		}
+
+		labels = append(labels, strings.TrimSpace(label))
+	}
+}
+
+// FindVM - VM config of domain, keyed by domain UUID, by domain name, or selected by VM `Match`
+//
+// Exact keys take priority, then selectors in MatchTiers order. Several VMs selecting domain within same tier is an error.
+func (c *Config) FindVM(domCfg *libvirtxml.Domain) (string, VM, error) {
+	// check config for defined VM by UUID
+	if vm, ok := c.VMs[domCfg.UUID]; ok {
+		return domCfg.UUID, vm, nil
+	}
+
+	// check config for defined VM by Name
+	if vm, ok := c.VMs[domCfg.Name]; ok {
+		return domCfg.Name, vm, nil
+	}
+
+	labels, err := DomainLabels(domCfg)
+	if err != nil {
+		return "", VM{}, err
+	}
+
+	// selectors, VMs grouped by tier
+	matched := make([][]string, len(MatchTiers))
+
+	for name, vm := range c.VMs {
+		if vm.Match == nil || !vm.Match.Matches(domCfg, labels) {
+			continue
+		}
+
+		tier := vm.Match.Tier()
+		matched[tier] = append(matched[tier], name)
+	}
+
+	for tier, names := range matched {
+		switch len(names) {
+		case 0:
+			continue
+		case 1:
+			return names[0], c.VMs[names[0]], nil
+		default:
+			sort.Strings(names)
+
+			return "", VM{}, fmt.Errorf("ambiguous match for UUID='%s' Name='%s': VMs '%s' match by %s",
+				domCfg.UUID, domCfg.Name, strings.Join(names, "', '"), MatchTiers[tier])
+		}
+	}
+
+	return "", VM{}, fmt.Errorf("%w for UUID='%s' or Name='%s'", ErrVMNotFound, domCfg.UUID, domCfg.Name)
+}
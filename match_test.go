@@ -0,0 +1,124 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	libvirtxml "github.com/libvirt/libvirt-go-xml"
+)
+
+// testMatchDomainXML - ephemeral CI runner with hook label in metadata
+const testMatchDomainXML = `<domain type='kvm'>
+  <name>ci-runner-17</name>
+  <uuid>8b5c4a64-4c44-4c4e-9d2d-4f7a1b7e0a17</uuid>
+  <title>CI runner (ephemeral)</title>
+  <metadata>
+    <other:info xmlns:other="https://example.com/other"><other:label>other</other:label></other:info>
+    <qemu-hook:labels xmlns:qemu-hook="https://github.com/s3rj1k/go-libvirt-custom-hook">
+      <qemu-hook:label>ci</qemu-hook:label>
+      <qemu-hook:label>gpu</qemu-hook:label>
+    </qemu-hook:labels>
+  </metadata>
+  <devices>
+    <interface type='direct'>
+      <mac address='52:54:00:9a:01:17'/>
+      <source dev='vl-9a0117' mode='passthrough'/>
+    </interface>
+  </devices>
+</domain>`
+
+func TestDomainLabels(t *testing.T) {
+	domCfg := new(libvirtxml.Domain)
+
+	err := domCfg.Unmarshal(testMatchDomainXML)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	labels, err := DomainLabels(domCfg)
+	if err != nil || strings.Join(labels, ",") != "ci,gpu" {
+		t.Errorf("Got : %v, %v\n Want: [ci gpu]\n", labels, err)
+	}
+}
+
+func TestFindVM(t *testing.T) {
+	domCfg := new(libvirtxml.Domain)
+
+	err := domCfg.Unmarshal(testMatchDomainXML)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		caseDescription string
+		vms             map[string]*Match
+		want            string
+		err             string
+	}{
+		{
+			caseDescription: "name glob",
+			vms:             map[string]*Match{"ci": {Name: "ci-runner-*"}, "db": {Name: "db-*"}},
+			want:            "ci",
+		},
+		{
+			caseDescription: "name regex is anchored",
+			vms:             map[string]*Match{"ci": {NameRegex: `ci-runner-\d+`}, "part": {NameRegex: "runner"}},
+			want:            "ci",
+		},
+		{
+			caseDescription: "exact name before selectors",
+			vms:             map[string]*Match{"ci-runner-17": nil, "ci": {MAC: "52:54:00:9a:01:17"}},
+			want:            "ci-runner-17",
+		},
+		{
+			caseDescription: "MAC before label before title before name",
+			vms: map[string]*Match{
+				"by-name":  {Name: "ci-*"},
+				"by-title": {Title: "CI runner*"},
+				"by-label": {Label: "gpu"},
+				"by-mac":   {MAC: "52:54:00:9A:01:17"},
+			},
+			want: "by-mac",
+		},
+		{
+			caseDescription: "label before title",
+			vms:             map[string]*Match{"by-title": {Title: "CI runner*"}, "by-label": {Label: "ci"}},
+			want:            "by-label",
+		},
+		{
+			caseDescription: "all fields must match",
+			vms:             map[string]*Match{"gpu-db": {Label: "gpu", Name: "db-*"}, "ci": {Name: "ci-*"}},
+			want:            "ci",
+		},
+		{
+			caseDescription: "label of other namespace is ignored",
+			vms:             map[string]*Match{"other": {Label: "other"}},
+			err:             "no VM found in config",
+		},
+		{
+			caseDescription: "ambiguous match within tier",
+			vms:             map[string]*Match{"ci-b": {Name: "ci-*"}, "ci-a": {NameRegex: "ci-.*"}, "gpu": {Title: "GPU*"}},
+			err:             "VMs 'ci-a', 'ci-b' match by Name",
+		},
+	}
+
+	for _, testCase := range cases {
+		cfg := &Config{VMs: make(map[string]VM)}
+		for name, match := range testCase.vms {
+			cfg.VMs[name] = VM{Match: match}
+		}
+
+		got, _, err := cfg.FindVM(domCfg)
+		if testCase.err != "" {
+			if err == nil || !strings.Contains(err.Error(), testCase.err) {
+				t.Errorf("TestCase: %s\n Got : %v\n Want: %s\n", testCase.caseDescription, err, testCase.err)
+			}
+
+			continue
+		}
+
+		if err != nil || got != testCase.want {
+			t.Errorf("TestCase: %s\n Got : %s, %v\n Want: %s\n", testCase.caseDescription, got, err, testCase.want)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base32"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxIfaceNameLength - IFNAMSIZ without trailing NUL
+const maxIfaceNameLength = 15
+
+// NilUUID - UUID used to render names when domain UUID is unknown
+const NilUUID = "00000000-0000-0000-0000-000000000000"
+
+// DefaultNaming - templates used for omitted `Naming` fields
+var DefaultNaming = Naming{
+	Upper:  "vu-{hash:12}",
+	Source: "vl-{hash:12}",
+	Target: "if-{hash:12}",
+	VxLAN:  "vx-{hash:12}",
+}
+
+// minNamePlaceholderBits - entropy of widest placeholder, `{uuid:8}` or `{hash:7}` at least
+//
+// Two of n domains share name with probability about n²/2³³, e.g. 1e-4 for 1000 domains, defaults take 60 bits.
+const minNamePlaceholderBits = 32
+
+// namePlaceholderBits - entropy of one character of placeholder: hex digit of UUID or base32 character of hash
+var namePlaceholderBits = map[string]int{"uuid": 4, "hash": 5}
+
+// namePlaceholder - `{uuid:N}` or `{hash:N}`
+var namePlaceholder = regexp.MustCompile(`\{(uuid|hash):([0-9]+)\}`)
+
+// nameLiteral - characters allowed outside of placeholders
+var nameLiteral = regexp.MustCompile(`^[a-zA-Z0-9-]*$`)
+
+// uuidPattern - UUID as reported by libvirt
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// nameEncoding - lowercase base32 without padding, all characters are valid in interface names
+var nameEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// IsUUID - reports whether string is UUID
+func IsUUID(s string) bool {
+	return uuidPattern.MatchString(s)
+}
+
+// namePlaceholderSource - characters placeholder takes its value from
+func namePlaceholderSource(kind, uuid string) string {
+	uuid = strings.ToLower(uuid)
+
+	if kind == "uuid" {
+		return strings.ReplaceAll(uuid, "-", "")
+	}
+
+	sum := sha256.Sum256([]byte(uuid))
+
+	return nameEncoding.EncodeToString(sum[:])
+}
+
+// CheckNameTemplate - validates template: literals are valid in interface names, placeholders fit their source,
+// widest placeholder keeps names of different UUIDs apart and rendered name fits IFNAMSIZ
+func CheckNameTemplate(template string) error {
+	matches := namePlaceholder.FindAllStringSubmatchIndex(template, -1)
+	if len(matches) == 0 {
+		return fmt.Errorf("template '%s' has no `{uuid:N}` or `{hash:N}` placeholder", template)
+	}
+
+	var length, last, bits int
+
+	for _, m := range matches {
+		literal := template[last:m[0]]
+		if !nameLiteral.MatchString(literal) {
+			return fmt.Errorf("template '%s' has invalid characters in '%s'", template, literal)
+		}
+
+		kind := template[m[2]:m[3]]
+		n, _ := strconv.Atoi(template[m[4]:m[5]])
+
+		if n < 1 || n > len(namePlaceholderSource(kind, NilUUID)) {
+			return fmt.Errorf("template '%s' has out of range length in '%s'", template, template[m[0]:m[1]])
+		}
+
+		bits = max(bits, n*namePlaceholderBits[kind])
+		length += len(literal) + n
+		last = m[1]
+	}
+
+	if bits < minNamePlaceholderBits {
+		return fmt.Errorf("template '%s' has too short placeholder, names of different UUIDs may collide, use at least `{uuid:8}` or `{hash:7}`", template)
+	}
+
+	if !nameLiteral.MatchString(template[last:]) {
+		return fmt.Errorf("template '%s' has invalid characters in '%s'", template, template[last:])
+	}
+
+	length += len(template) - last
+
+	if length > maxIfaceNameLength {
+		return fmt.Errorf("template '%s' renders %d characters, interface names are limited to %d", template, length, maxIfaceNameLength)
+	}
+
+	return nil
+}
+
+// RenderName - renders interface name from template and domain UUID
+func RenderName(template, uuid string) string {
+	return namePlaceholder.ReplaceAllStringFunc(template, func(p string) string {
+		m := namePlaceholder.FindStringSubmatch(p)
+		n, _ := strconv.Atoi(m[2])
+
+		source := namePlaceholderSource(m[1], uuid)
+		if n > len(source) {
+			n = len(source)
+		}
+
+		return source[:n]
+	})
+}
+
+// Templates - effective templates keyed by interface role, defaults are used for omitted ones
+func (n *Naming) Templates() map[string]string {
+	t := DefaultNaming
+	if n != nil {
+		mergeValue(reflect.ValueOf(&t).Elem(), reflect.ValueOf(*n))
+	}
+
+	return map[string]string{
+		"Upper":  t.Upper,
+		"Source": t.Source,
+		"Target": t.Target,
+		"VxLAN":  t.VxLAN,
+	}
+}
+
+// namePrefix - literal part of template before first placeholder
+func namePrefix(template string) string {
+	loc := namePlaceholder.FindStringIndex(template)
+	if loc == nil {
+		return template
+	}
+
+	return template[:loc[0]]
+}
+
+// Check - validates templates, ensures templates of different roles never render same name for any UUIDs and VMs never share interface name
+//
+// Names differ when literal prefixes differ at some position before either prefix ends. Names of VMs keyed by UUID are
+// rendered, VMs keyed by name or selected by Match get UUID only at runtime, so their templated names are left to
+// CheckInterfaceOwner, which refuses links owned by other domain and stays final backstop for any collision.
+func (n *Naming) Check(vms map[string]VM) error {
+	if n != nil {
+		err := n.checkTemplates()
+		if err != nil {
+			return err
+		}
+	}
+
+	keys := make([]string, 0, len(vms))
+	for key := range vms {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	// interface name to VM using it
+	owners := make(map[string]string)
+
+	for _, key := range keys {
+		vm := vms[key]
+		if IsUUID(key) {
+			vm = n.Apply(vm, key)
+		}
+
+		for _, name := range vm.InterfaceNames() {
+			if owner, ok := owners[name]; ok && owner != key {
+				return &FieldError{Field: "VMs." + key, Err: fmt.Errorf("naming: VMs '%s' and '%s' both use interface name '%s'", owner, key, name)}
+			}
+
+			owners[name] = key
+		}
+	}
+
+	return nil
+}
+
+// checkTemplates - validates templates and ensures templates of different roles never render same name
+func (n *Naming) checkTemplates() error {
+	templates := n.Templates()
+	roles := []string{"Upper", "Source", "Target", "VxLAN"}
+
+	for _, role := range roles {
+		err := CheckNameTemplate(templates[role])
+		if err != nil {
+			return &FieldError{Field: "Naming." + role, Err: fmt.Errorf("naming %s: %s", role, err)}
+		}
+	}
+
+	for i, a := range roles {
+		for _, b := range roles[i+1:] {
+			pa, pb := namePrefix(templates[a]), namePrefix(templates[b])
+
+			if strings.HasPrefix(pa, pb) || strings.HasPrefix(pb, pa) {
+				return &FieldError{Field: "Naming." + b, Err: fmt.Errorf("naming templates of %s '%s' and %s '%s' may render same name, their prefixes must differ", a, templates[a], b, templates[b])}
+			}
+		}
+	}
+
+	return nil
+}
+
+// InterfaceNames - names of interfaces owned by VM alone, shared VxLAN source is left out
+func (vm VM) InterfaceNames() []string {
+	if vm.Interface == nil {
+		return nil
+	}
+
+	var names []string
+
+	add := func(iface *Iface) {
+		if iface != nil && iface.Name != "" {
+			names = append(names, iface.Name)
+		}
+	}
+
+	if vm.Interface.L3 != nil {
+		add(vm.Interface.L3.Upper)
+		add(vm.Interface.L3.Source)
+		add(vm.Interface.L3.Target)
+	}
+
+	if vm.Interface.VxLAN != nil {
+		add(vm.Interface.VxLAN.Target)
+	}
+
+	return names
+}
+
+// Apply - returns copy of VM config with omitted interface names derived from domain UUID, VM config is left untouched
+func (n *Naming) Apply(vm VM, uuid string) VM {
+	if n == nil || vm.Interface == nil {
+		return vm
+	}
+
+	var out VM
+
+	mergeValue(reflect.ValueOf(&out).Elem(), reflect.ValueOf(vm))
+
+	templates := n.Templates()
+
+	derive := func(iface **Iface, role string) {
+		if *iface == nil {
+			*iface = new(Iface)
+		}
+
+		if (*iface).Name == "" {
+			(*iface).Name = RenderName(templates[role], uuid)
+		}
+	}
+
+	// taps of bound NICs are named by domain XML
+	if out.Interface.L3 != nil {
+		derive(&out.Interface.L3.Upper, "Upper")
+		derive(&out.Interface.L3.Source, "Source")
+
+		if out.Interface.L3.NIC == nil {
+			derive(&out.Interface.L3.Target, "Target")
+		}
+	}
+
+	if out.Interface.VxLAN != nil && out.Interface.VxLAN.NIC == nil {
+		derive(&out.Interface.VxLAN.Target, "VxLAN")
+	}
+
+	return out
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	libvirtxml "github.com/libvirt/libvirt-go-xml"
+)
+
+func TestCheckNameTemplate(t *testing.T) {
+	cases := []struct {
+		caseDescription string
+		template        string
+		err             string
+	}{
+		{caseDescription: "hash placeholder", template: "vu-{hash:12}"},
+		{caseDescription: "several placeholders", template: "v{uuid:4}-{hash:8}"},
+		{caseDescription: "no placeholder", template: "vu-9a0101", err: "has no `{uuid:N}` or `{hash:N}` placeholder"},
+		{caseDescription: "too long", template: "vu-{hash:13}", err: "renders 16 characters"},
+		{caseDescription: "invalid literal", template: "vu_{hash:12}", err: "invalid characters in 'vu_'"},
+		{caseDescription: "zero length", template: "vu-{uuid:0}", err: "out of range length"},
+		{caseDescription: "longer than UUID", template: "{uuid:33}", err: "out of range length"},
+		{caseDescription: "too short hash", template: "vu-{hash:1}", err: "has too short placeholder"},
+		{caseDescription: "too short UUID", template: "vu-{uuid:7}", err: "has too short placeholder"},
+		{caseDescription: "shortest hash", template: "vu-{hash:7}"},
+	}
+
+	for _, testCase := range cases {
+		err := CheckNameTemplate(testCase.template)
+		if testCase.err == "" && err != nil || testCase.err != "" && (err == nil || !strings.Contains(err.Error(), testCase.err)) {
+			t.Errorf("TestCase: %s\n Got : %v\n Want: %s\n", testCase.caseDescription, err, testCase.err)
+		}
+	}
+}
+
+func TestRenderName(t *testing.T) {
+	uuid := "8B5C4A64-4c44-4c4e-9d2d-4f7a1b7e0a01"
+
+	if got := RenderName("vu-{uuid:8}", uuid); got != "vu-8b5c4a64" {
+		t.Errorf("TestCase: uuid placeholder\n Got : %s\n Want: vu-8b5c4a64\n", got)
+	}
+
+	got := RenderName("vu-{hash:12}", uuid)
+	if len(got) != 15 || !strings.HasPrefix(got, "vu-") {
+		t.Errorf("TestCase: hash placeholder\n Got : %s\n Want: 15 characters name\n", got)
+	}
+
+	if other := RenderName("vu-{hash:12}", "8b5c4a64-4c44-4c4e-9d2d-4f7a1b7e0a02"); other == got {
+		t.Errorf("TestCase: hash of other UUID\n Got : %s\n Want: other name\n", other)
+	}
+}
+
+func TestNamingCheck(t *testing.T) {
+	cases := []struct {
+		caseDescription string
+		naming          *Naming
+		vms             map[string]VM
+		err             string
+	}{
+		{caseDescription: "no naming scheme", naming: nil},
+		{caseDescription: "defaults", naming: &Naming{}},
+		{caseDescription: "same prefix", naming: &Naming{Upper: "v-{hash:12}", Source: "v-{uuid:12}"}, err: "Upper 'v-{hash:12}' and Source 'v-{uuid:12}'"},
+		{caseDescription: "prefix of other prefix", naming: &Naming{Target: "i{hash:12}", VxLAN: "if{hash:12}"}, err: "Target 'i{hash:12}' and VxLAN 'if{hash:12}'"},
+		{caseDescription: "no prefix", naming: &Naming{Upper: "{hash:12}"}, err: "Upper '{hash:12}'"},
+		{caseDescription: "invalid template", naming: &Naming{Upper: "vu-{hash:13}"}, err: "naming Upper: template 'vu-{hash:13}' renders 16 characters"},
+		{
+			caseDescription: "rendered names of VMs differ",
+			naming:          &Naming{Upper: "vu-{uuid:8}", Source: "vl-{uuid:8}"},
+			vms: map[string]VM{
+				"8b5c4a64-4c44-4c4e-9d2d-4f7a1b7e0a01": namingTestVM(""),
+				"9c5c4a64-4c44-4c4e-9d2d-4f7a1b7e0a02": namingTestVM(""),
+			},
+		},
+		{
+			caseDescription: "rendered names of VMs collide",
+			naming:          &Naming{Upper: "vu-{uuid:8}", Source: "vl-{uuid:8}"},
+			vms: map[string]VM{
+				"8b5c4a64-4c44-4c4e-9d2d-4f7a1b7e0a01": namingTestVM(""),
+				"8b5c4a64-0000-4c4e-9d2d-4f7a1b7e0a02": namingTestVM(""),
+			},
+			err: "naming: VMs '8b5c4a64-0000-4c4e-9d2d-4f7a1b7e0a02' and '8b5c4a64-4c44-4c4e-9d2d-4f7a1b7e0a01' both use interface name 'vu-8b5c4a64'",
+		},
+		{
+			caseDescription: "rendered name collides with configured name",
+			naming:          &Naming{Upper: "vu-{uuid:8}", Source: "vl-{uuid:8}"},
+			vms: map[string]VM{
+				"8b5c4a64-4c44-4c4e-9d2d-4f7a1b7e0a01": namingTestVM(""),
+				"vm2":                                  namingTestVM("vu-8b5c4a64"),
+			},
+			err: "both use interface name 'vu-8b5c4a64'",
+		},
+		{
+			caseDescription: "configured names collide without naming scheme",
+			vms: map[string]VM{
+				"vm1": namingTestVM("vu-9a0101"),
+				"vm2": namingTestVM("vu-9a0101"),
+			},
+			err: "naming: VMs 'vm1' and 'vm2' both use interface name 'vu-9a0101'",
+		},
+		{
+			caseDescription: "VMs keyed by name get UUID at runtime",
+			naming:          &Naming{Upper: "vu-{uuid:8}", Source: "vl-{uuid:8}"},
+			vms: map[string]VM{
+				"vm1": namingTestVM(""),
+				"vm2": namingTestVM(""),
+			},
+		},
+	}
+
+	for _, testCase := range cases {
+		err := testCase.naming.Check(testCase.vms)
+		if testCase.err == "" && err != nil || testCase.err != "" && (err == nil || !strings.Contains(err.Error(), testCase.err)) {
+			t.Errorf("TestCase: %s\n Got : %v\n Want: %s\n", testCase.caseDescription, err, testCase.err)
+		}
+	}
+}
+
+// namingTestVM - VM with L3 interface, upper peer named when name is set
+func namingTestVM(upper string) VM {
+	vm := VM{Interface: &Interface{L3: &L3{}}}
+	if upper != "" {
+		vm.Interface.L3.Upper = &Iface{Name: upper}
+	}
+
+	return vm
+}
+
+func TestLookupVMConfigNaming(t *testing.T) {
+	tc := &TC{Rate: 250, Burst: 256, Limit: 10240}
+
+	cfg := &Config{
+		Naming: &Naming{Upper: "vu-{uuid:8}", Source: "vl-{uuid:8}", Target: "if-{uuid:8}", VxLAN: "vx-{uuid:8}"},
+		VMs: map[string]VM{
+			"vm1": {Interface: &Interface{
+				Uplink: &Iface{"bond-wan"},
+				VxLAN:  &VxLAN{VNI: 42, Source: &Iface{"x-42"}, TC: tc},
+				L3:     &L3{IPv4: []string{"195.177.118.111"}, Target: &Iface{"tap-vm1"}, TC: tc},
+			}},
+		},
+	}
+
+	vm, err := cfg.LookupVMConfig(&libvirtxml.Domain{Name: "vm1", UUID: "8b5c4a64-4c44-4c4e-9d2d-4f7a1b7e0a01"})
+	if err != nil {
+		t.Fatalf("Got : %s\n Want: nil", err)
+	}
+
+	got := []string{vm.Interface.L3.Upper.Name, vm.Interface.L3.Source.Name, vm.Interface.L3.Target.Name, vm.Interface.VxLAN.Target.Name}
+	want := []string{"vu-8b5c4a64", "vl-8b5c4a64", "tap-vm1", "vx-8b5c4a64"}
+
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("TestCase: derived names\n Got : %v\n Want: %v\n", got, want)
+	}
+
+	// configured VM keeps omitted names, for other domains
+	if cfg.VMs["vm1"].Interface.L3.Upper != nil {
+		t.Errorf("TestCase: configured VM\n Got : %v\n Want: nil", cfg.VMs["vm1"].Interface.L3.Upper)
+	}
+}
+
+func TestCreateVethInterfaceOwner(t *testing.T) {
+	owner := NewMarker("8b5c4a64-4c44-4c4e-9d2d-4f7a1b7e0a01", "vm1")
+
+	cases := []struct {
+		caseDescription string
+		alias           string
+		err             string
+	}{
+		{caseDescription: "link of same domain", alias: owner.String()},
+		{caseDescription: "link without alias", alias: ""},
+		{caseDescription: "link of other domain", alias: NewMarker("8b5c4a64-4c44-4c4e-9d2d-4f7a1b7e0a02", "vm2").String(), err: "link 'vu-9a0101' is owned by other domain"},
+		{caseDescription: "link not created by hook", alias: "uplink", err: "link 'vu-9a0101' exists and is not owned by hook"},
+	}
+
+	for _, testCase := range cases {
+		s, r := NewRecordingSystem(t)
+
+		r.ReturnCodes["ip link add name vu-9a0101 type veth peer name vl-9a0101"] = 2
+		r.Outputs["ip -j link show dev vu-9a0101"] = `[{"ifname": "vu-9a0101", "ifalias": "` + testCase.alias + `"}]`
+		r.Outputs["ip -j link show dev vl-9a0101"] = `[{"ifname": "vl-9a0101"}]`
+
+		err := s.CreateVethInterface("vu-9a0101", "vl-9a0101", owner)
+		if testCase.err == "" && err != nil || testCase.err != "" && (err == nil || !strings.Contains(err.Error(), testCase.err)) {
+			t.Errorf("TestCase: %s\n Got : %v\n Want: %s\n", testCase.caseDescription, err, testCase.err)
+		}
+	}
+}
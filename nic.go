@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+
+	libvirtxml "github.com/libvirt/libvirt-go-xml"
+)
+
+// String - selector as written in errors: `MAC '52:54:00:9a:01:01'`, `alias 'ua-wan'` or both
+func (n *NIC) String() string {
+	switch {
+	case n.MAC != "" && n.Alias != "":
+		return fmt.Sprintf("MAC '%s' and alias '%s'", n.MAC, n.Alias)
+	case n.MAC != "":
+		return fmt.Sprintf("MAC '%s'", n.MAC)
+	default:
+		return fmt.Sprintf("alias '%s'", n.Alias)
+	}
+}
+
+// isSameMAC - compares MAC addresses regardless of case and separators
+func isSameMAC(a, b string) bool {
+	ha, err := net.ParseMAC(a)
+	if err != nil {
+		return false
+	}
+
+	hb, err := net.ParseMAC(b)
+	if err != nil {
+		return false
+	}
+
+	return ha.String() == hb.String()
+}
+
+// Match - reports whether domain interface is selected by NIC
+func (n *NIC) Match(iface *libvirtxml.DomainInterface) bool {
+	if n.MAC != "" && (iface.MAC == nil || !isSameMAC(n.MAC, iface.MAC.Address)) {
+		return false
+	}
+
+	if n.Alias != "" && (iface.Alias == nil || iface.Alias.Name != n.Alias) {
+		return false
+	}
+
+	return true
+}
+
+// Find - domain interface selected by NIC, exactly one must match
+func (n *NIC) Find(domCfg *libvirtxml.Domain) (*libvirtxml.DomainInterface, error) {
+	var found *libvirtxml.DomainInterface
+
+	if domCfg.Devices != nil {
+		for i := range domCfg.Devices.Interfaces {
+			iface := &domCfg.Devices.Interfaces[i]
+			if !n.Match(iface) {
+				continue
+			}
+
+			if found != nil {
+				return nil, fmt.Errorf("more than one domain interface with %s", n)
+			}
+
+			found = iface
+		}
+	}
+
+	if found == nil {
+		return nil, fmt.Errorf("no domain interface with %s", n)
+	}
+
+	return found, nil
+}
+
+// bindNIC - takes tap name from domain interface, which must be macvtap on source link
+func bindNIC(nic *NIC, source *Iface, target **Iface, domCfg *libvirtxml.Domain) error {
+	iface, err := nic.Find(domCfg)
+	if err != nil {
+		return err
+	}
+
+	// `<interface type='direct'><source dev='vl-9a0101' mode='...'/>`
+	if iface.Source == nil || iface.Source.Direct == nil {
+		return fmt.Errorf("domain interface with %s is not type='direct'", nic)
+	}
+
+	if source != nil && iface.Source.Direct.Dev != source.Name {
+		return fmt.Errorf("domain interface with %s has source dev '%s', config expects '%s'", nic, iface.Source.Direct.Dev, source.Name)
+	}
+
+	// `<target dev='if-9a0101'/>`, tap name must be fixed in domain XML for hook to find it
+	if iface.Target == nil || iface.Target.Dev == "" {
+		return fmt.Errorf("domain interface with %s has no tap, set `<target dev='...'/>` in domain XML", nic)
+	}
+
+	if *target != nil && (*target).Name != "" && (*target).Name != iface.Target.Dev {
+		return fmt.Errorf("domain interface with %s has tap '%s', config expects '%s'", nic, iface.Target.Dev, (*target).Name)
+	}
+
+	*target = &Iface{Name: iface.Target.Dev}
+
+	return nil
+}
+
+// BindNICs - returns copy of VM config with taps of bound NICs taken from domain XML, VM config is left untouched
+func BindNICs(vm VM, domCfg *libvirtxml.Domain) (VM, error) {
+	if vm.Interface == nil {
+		return vm, nil
+	}
+
+	var out VM
+
+	mergeValue(reflect.ValueOf(&out).Elem(), reflect.ValueOf(vm))
+
+	if l3 := out.Interface.L3; l3 != nil && l3.NIC != nil {
+		err := bindNIC(l3.NIC, l3.Source, &l3.Target, domCfg)
+		if err != nil {
+			return VM{}, fmt.Errorf("L3: %s", err)
+		}
+	}
+
+	if vxlan := out.Interface.VxLAN; vxlan != nil && vxlan.NIC != nil {
+		err := bindNIC(vxlan.NIC, vxlan.Source, &vxlan.Target, domCfg)
+		if err != nil {
+			return VM{}, fmt.Errorf("VxLAN: %s", err)
+		}
+	}
+
+	return out, nil
+}
+
+// BoundTargets - namespaces of Target fields taken from domain XML, for validation without domain XML
+func BoundTargets(vm VM) []string {
+	var fields []string
+
+	if vm.Interface == nil {
+		return fields
+	}
+
+	if vm.Interface.L3 != nil && vm.Interface.L3.NIC != nil {
+		fields = append(fields, "Interface.L3.Target")
+	}
+
+	if vm.Interface.VxLAN != nil && vm.Interface.VxLAN.NIC != nil {
+		fields = append(fields, "Interface.VxLAN.Target")
+	}
+
+	return fields
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	libvirtxml "github.com/libvirt/libvirt-go-xml"
+)
+
+// testDomainXML - domain with macvtap NICs on lower veth peer and shared VxLAN
+const testDomainXML = `<domain type='kvm'>
+  <name>vm1</name>
+  <uuid>8b5c4a64-4c44-4c4e-9d2d-4f7a1b7e0a01</uuid>
+  <devices>
+    <interface type='direct'>
+      <mac address='52:54:00:9a:01:01'/>
+      <source dev='vl-9a0101' mode='passthrough'/>
+      <target dev='if-9a0101'/>
+      <alias name='ua-wan'/>
+    </interface>
+    <interface type='direct'>
+      <mac address='52:54:00:9a:01:02'/>
+      <source dev='x-42' mode='bridge'/>
+      <target dev='vx-9a0101'/>
+      <alias name='ua-lan'/>
+    </interface>
+    <interface type='direct'>
+      <mac address='52:54:00:9a:01:03'/>
+      <source dev='x-42' mode='bridge'/>
+      <alias name='ua-notap'/>
+    </interface>
+    <interface type='bridge'>
+      <mac address='52:54:00:9a:01:04'/>
+      <source bridge='br0'/>
+      <target dev='vnet4'/>
+    </interface>
+  </devices>
+</domain>`
+
+func TestBindNICs(t *testing.T) {
+	domCfg := new(libvirtxml.Domain)
+
+	err := domCfg.Unmarshal(testDomainXML)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		caseDescription string
+		l3              *NIC
+		l3Target        *Iface
+		vxlan           *NIC
+		want            []string // L3 and VxLAN taps
+		err             string
+	}{
+		{
+			caseDescription: "no binding keeps config",
+			l3Target:        &Iface{"if-9a0101"},
+			want:            []string{"if-9a0101", ""},
+		},
+		{
+			caseDescription: "bound by MAC and alias",
+			l3:              &NIC{MAC: "52:54:00:9A:01:01"},
+			vxlan:           &NIC{Alias: "ua-lan"},
+			want:            []string{"if-9a0101", "vx-9a0101"},
+		},
+		{
+			caseDescription: "MAC and alias of same interface",
+			l3:              &NIC{MAC: "52:54:00:9a:01:01", Alias: "ua-wan"},
+			l3Target:        &Iface{"if-9a0101"},
+			want:            []string{"if-9a0101", ""},
+		},
+		{
+			caseDescription: "MAC and alias of different interfaces",
+			l3:              &NIC{MAC: "52:54:00:9a:01:01", Alias: "ua-lan"},
+			err:             "L3: no domain interface with MAC '52:54:00:9a:01:01' and alias 'ua-lan'",
+		},
+		{
+			caseDescription: "missing interface",
+			l3:              &NIC{MAC: "52:54:00:9a:01:99"},
+			err:             "L3: no domain interface with MAC '52:54:00:9a:01:99'",
+		},
+		{
+			caseDescription: "configured tap differs",
+			l3:              &NIC{Alias: "ua-wan"},
+			l3Target:        &Iface{"if-9a0102"},
+			err:             "L3: domain interface with alias 'ua-wan' has tap 'if-9a0101', config expects 'if-9a0102'",
+		},
+		{
+			caseDescription: "missing tap",
+			vxlan:           &NIC{Alias: "ua-notap"},
+			err:             "VxLAN: domain interface with alias 'ua-notap' has no tap",
+		},
+		{
+			caseDescription: "wrong interface type",
+			l3:              &NIC{MAC: "52:54:00:9a:01:04"},
+			err:             "L3: domain interface with MAC '52:54:00:9a:01:04' is not type='direct'",
+		},
+		{
+			caseDescription: "wrong source link",
+			l3:              &NIC{Alias: "ua-lan"},
+			err:             "L3: domain interface with alias 'ua-lan' has source dev 'x-42', config expects 'vl-9a0101'",
+		},
+	}
+
+	for _, testCase := range cases {
+		vm := VM{Interface: &Interface{
+			L3:    &L3{Source: &Iface{"vl-9a0101"}, Target: testCase.l3Target, NIC: testCase.l3},
+			VxLAN: &VxLAN{Source: &Iface{"x-42"}, NIC: testCase.vxlan},
+		}}
+
+		got, err := BindNICs(vm, domCfg)
+		if testCase.err != "" {
+			if err == nil || !strings.Contains(err.Error(), testCase.err) {
+				t.Errorf("TestCase: %s\n Got : %v\n Want: %s\n", testCase.caseDescription, err, testCase.err)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("TestCase: %s\n Got : %s\n Want: nil", testCase.caseDescription, err)
+
+			continue
+		}
+
+		taps := make([]string, 2)
+		for i, iface := range []*Iface{got.Interface.L3.Target, got.Interface.VxLAN.Target} {
+			if iface != nil {
+				taps[i] = iface.Name
+			}
+		}
+
+		if strings.Join(taps, ",") != strings.Join(testCase.want, ",") {
+			t.Errorf("TestCase: %s\n Got : %v\n Want: %v\n", testCase.caseDescription, taps, testCase.want)
+		}
+
+		// config is left untouched
+		if testCase.l3Target == nil && vm.Interface.L3.Target != nil {
+			t.Errorf("TestCase: %s\n Got : config modified\n Want: unchanged", testCase.caseDescription)
+		}
+	}
+}
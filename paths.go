@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// EnvConfigPath - environment variable overriding path to hook config
+const EnvConfigPath = "QEMU_HOOK_CONFIG"
+
+// EnvLogFilePath - environment variable overriding path to log file
+const EnvLogFilePath = "QEMU_HOOK_LOG"
+
+// Paths - locations of hook config and log file
+type Paths struct {
+	Config string
+	Log    string
+}
+
+// DefaultPaths - compile-time default locations
+func DefaultPaths() Paths {
+	return Paths{
+		Config: ConfigPath,
+		Log:    LogFilePath,
+	}
+}
+
+// SidecarPath - path to side-car env file next to hook binary: `/etc/libvirt/hooks/qemu` uses `/etc/libvirt/hooks/qemu-hook.env`
+func SidecarPath() string {
+	exe, err := os.Executable()
+	if err != nil {
+		exe = os.Args[0]
+	}
+
+	return filepath.Join(filepath.Dir(exe), filepath.Base(os.Args[0])+"-hook.env")
+}
+
+// ReadEnvFile - reads `KEY=VALUE` lines, empty lines and `#` comments are skipped, values may be quoted
+func ReadEnvFile(path string) (map[string]string, error) {
+	// prefix for errors logging
+	const errPrefix = "env file error:"
+
+	fd, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	env := make(map[string]string)
+
+	scanner := bufio.NewScanner(fd)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		if !ok {
+			return nil, fmt.Errorf("%s %s:%d: expected KEY=VALUE", errPrefix, path, n)
+		}
+
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+
+		env[strings.TrimSpace(key)] = value
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("%s %s", errPrefix, err)
+	}
+
+	return env, nil
+}
+
+// ResolvePaths - compile-time defaults, overridden by side-car env file, overridden by environment
+func ResolvePaths(sidecar string, getenv func(string) string) (Paths, error) {
+	paths := DefaultPaths()
+
+	// side-car env file is optional
+	env, err := ReadEnvFile(sidecar)
+	if err != nil && !os.IsNotExist(err) {
+		return paths, err
+	}
+
+	for _, lookup := range []func(string) string{
+		func(key string) string { return env[key] },
+		getenv,
+	} {
+		if v := lookup(EnvConfigPath); v != "" {
+			paths.Config = v
+		}
+
+		if v := lookup(EnvLogFilePath); v != "" {
+			paths.Log = v
+		}
+	}
+
+	return paths, nil
+}
+
+// AddFlags - registers flags overriding paths, for operator commands
+func (p *Paths) AddFlags(fs *flag.FlagSet) {
+	fs.StringVar(&p.Config, "config", p.Config, "path to hook config, env "+EnvConfigPath)
+	fs.StringVar(&p.Log, "log", p.Log, "path to log file, env "+EnvLogFilePath)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolvePaths(t *testing.T) {
+	dir := t.TempDir()
+
+	sidecar := filepath.Join(dir, "lxc-hook.env")
+
+	err := os.WriteFile(sidecar, []byte("# lxc hook instance\nQEMU_HOOK_CONFIG=/etc/libvirt/hooks/lxc-hook.json\nexport QEMU_HOOK_LOG=\"/var/log/libvirt/lxc/lxc-hook.log\"\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		caseDescription string
+		sidecar         string
+		env             map[string]string
+		paths           Paths
+	}{
+		{
+			caseDescription: "defaults",
+			sidecar:         filepath.Join(dir, "missing.env"),
+			paths:           DefaultPaths(),
+		},
+		{
+			caseDescription: "side-car env file",
+			sidecar:         sidecar,
+			paths:           Paths{Config: "/etc/libvirt/hooks/lxc-hook.json", Log: "/var/log/libvirt/lxc/lxc-hook.log"},
+		},
+		{
+			caseDescription: "environment overrides side-car env file",
+			sidecar:         sidecar,
+			env:             map[string]string{EnvConfigPath: "/tmp/qemu-hook.json"},
+			paths:           Paths{Config: "/tmp/qemu-hook.json", Log: "/var/log/libvirt/lxc/lxc-hook.log"},
+		},
+	}
+
+	for _, testCase := range cases {
+		paths, err := ResolvePaths(testCase.sidecar, func(key string) string { return testCase.env[key] })
+		if err != nil {
+			t.Fatalf("TestCase: %s\n Got : %s\n Want: nil", testCase.caseDescription, err)
+		}
+
+		if paths != testCase.paths {
+			t.Errorf("TestCase: %s\n Got : %+v\n Want: %+v\n", testCase.caseDescription, paths, testCase.paths)
+		}
+	}
+}
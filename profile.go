@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// ResolveVMs - replaces every VM with its effective config: `Defaults`, then `Profiles[vm.Profile]`, then host section, then VM itself
+func (c *Config) ResolveVMs() error {
+	// sorted, so first error is stable
+	names := make([]string, 0, len(c.VMs))
+	for name := range c.VMs {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		vm, err := c.ResolveVM(c.VMs[name])
+		if err != nil {
+			return &FieldError{Field: "VMs." + name, Err: fmt.Errorf("VM '%s': %s", name, err)}
+		}
+
+		c.VMs[name] = vm
+	}
+
+	return nil
+}
+
+// ResolveVM - effective VM config, fields are overridden one by one, defaults and profiles are never modified
+func (c *Config) ResolveVM(vm VM) (VM, error) {
+	if vm.Match != nil && vm.Match.IsEmpty() {
+		return VM{}, fmt.Errorf("empty Match selects no domain")
+	}
+
+	var layers []VM
+
+	if c.Defaults != nil {
+		if c.Defaults.Profile != "" {
+			return VM{}, fmt.Errorf("defaults can't reference profile '%s'", c.Defaults.Profile)
+		}
+
+		if c.Defaults.Match != nil {
+			return VM{}, fmt.Errorf("defaults can't set Match")
+		}
+
+		layers = append(layers, *c.Defaults)
+	}
+
+	var profile VM
+
+	if vm.Profile != "" {
+		var ok bool
+
+		profile, ok = c.Profiles[vm.Profile]
+		if !ok {
+			return VM{}, fmt.Errorf("unknown profile '%s'", vm.Profile)
+		}
+
+		if profile.Profile != "" {
+			return VM{}, fmt.Errorf("profile '%s' can't reference profile '%s'", vm.Profile, profile.Profile)
+		}
+
+		if profile.Match != nil {
+			return VM{}, fmt.Errorf("profile '%s' can't set Match", vm.Profile)
+		}
+	}
+
+	if vm.Profile != "" {
+		layers = append(layers, profile)
+	}
+
+	// host section overrides defaults and profile, VM has L3 or VxLAN when any layer defines it
+	var hasL3, hasVxLAN bool
+	for _, layer := range []*VM{c.Defaults, &profile, &vm} {
+		if layer == nil || layer.Interface == nil {
+			continue
+		}
+
+		hasL3 = hasL3 || layer.Interface.L3 != nil
+		hasVxLAN = hasVxLAN || layer.Interface.VxLAN != nil
+	}
+
+	if host, ok := c.hostLayer(hasL3, hasVxLAN); ok {
+		layers = append(layers, host)
+	}
+
+	layers = append(layers, vm)
+
+	var out VM
+
+	for _, layer := range layers {
+		mergeValue(reflect.ValueOf(&out).Elem(), reflect.ValueOf(layer))
+	}
+
+	out.Profile = vm.Profile
+	out.Source = vm.Source
+
+	return out, nil
+}
+
+// mergeValue - overlays set fields of src struct onto dst struct
+//
+// Nested structs are merged field by field into newly allocated values, so dst never shares memory with src.
+// Zero scalars and nil slices are unset, empty slice clears inherited one.
+func mergeValue(dst, src reflect.Value) {
+	for i := 0; i < src.NumField(); i++ {
+		df, sf := dst.Field(i), src.Field(i)
+
+		switch sf.Kind() {
+		case reflect.Ptr:
+			if sf.IsNil() {
+				continue
+			}
+
+			if df.IsNil() {
+				df.Set(reflect.New(sf.Type().Elem()))
+			}
+
+			mergeValue(df.Elem(), sf.Elem())
+		case reflect.Struct:
+			mergeValue(df, sf)
+		case reflect.Slice:
+			if sf.IsNil() {
+				continue
+			}
+
+			df.Set(reflect.AppendSlice(reflect.MakeSlice(sf.Type(), 0, sf.Len()), sf))
+		default:
+			if !sf.IsZero() {
+				df.Set(sf)
+			}
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResolveVM(t *testing.T) {
+	tc := &TC{Rate: 250, Burst: 256, Limit: 10240}
+
+	cfg := &Config{
+		Defaults: &VM{
+			Interface: &Interface{
+				Uplink: &Iface{"bond-wan"},
+				L3:     &L3{IPv6: []string{"2a02:2278:100:1::1"}, TC: &TC{Rate: 100, Burst: 128, Limit: 10240}},
+			},
+		},
+		Profiles: map[string]VM{
+			"standard-250mbit": {Interface: &Interface{L3: &L3{TC: &TC{Rate: 250, Burst: 256}}}},
+			"nested":           {Profile: "standard-250mbit"},
+		},
+	}
+
+	cases := []struct {
+		caseDescription string
+		vm              VM
+		want            VM
+		err             string
+	}{
+		{
+			caseDescription: "defaults only",
+			vm:              VM{Interface: &Interface{L3: &L3{IPv4: []string{"195.177.118.111"}}}},
+			want: VM{Interface: &Interface{
+				Uplink: &Iface{"bond-wan"},
+				L3:     &L3{IPv4: []string{"195.177.118.111"}, IPv6: []string{"2a02:2278:100:1::1"}, TC: &TC{Rate: 100, Burst: 128, Limit: 10240}},
+			}},
+		},
+		{
+			caseDescription: "profile overrides defaults field by field",
+			vm:              VM{Profile: "standard-250mbit", Source: "vm1.json"},
+			want: VM{Profile: "standard-250mbit", Source: "vm1.json", Interface: &Interface{
+				Uplink: &Iface{"bond-wan"},
+				L3:     &L3{IPv6: []string{"2a02:2278:100:1::1"}, TC: tc},
+			}},
+		},
+		{
+			caseDescription: "VM overrides profile, empty list clears inherited one",
+			vm:              VM{Profile: "standard-250mbit", Interface: &Interface{Uplink: &Iface{"bond-lan"}, L3: &L3{IPv6: []string{}, TC: &TC{Limit: 20480}}}},
+			want: VM{Profile: "standard-250mbit", Interface: &Interface{
+				Uplink: &Iface{"bond-lan"},
+				L3:     &L3{IPv6: []string{}, TC: &TC{Rate: 250, Burst: 256, Limit: 20480}},
+			}},
+		},
+		{
+			caseDescription: "unknown profile",
+			vm:              VM{Profile: "standard-1gbit"},
+			err:             "unknown profile 'standard-1gbit'",
+		},
+		{
+			caseDescription: "profile referencing profile",
+			vm:              VM{Profile: "nested"},
+			err:             "profile 'nested' can't reference profile 'standard-250mbit'",
+		},
+	}
+
+	for _, testCase := range cases {
+		got, err := cfg.ResolveVM(testCase.vm)
+		if testCase.err != "" {
+			if err == nil || !strings.Contains(err.Error(), testCase.err) {
+				t.Errorf("TestCase: %s\n Got : %v\n Want: %s\n", testCase.caseDescription, err, testCase.err)
+			}
+
+			continue
+		}
+
+		if err != nil || !reflect.DeepEqual(got, testCase.want) {
+			t.Errorf("TestCase: %s\n Got : %+v, %v\n Want: %+v\n", testCase.caseDescription, got, err, testCase.want)
+		}
+
+		// effective config never shares memory with defaults and profiles
+		got.Interface.Uplink.Name = "changed"
+		got.Interface.L3.TC.Rate = 1
+
+		if cfg.Defaults.Interface.Uplink.Name != "bond-wan" || cfg.Defaults.Interface.L3.TC.Rate != 100 || cfg.Profiles["standard-250mbit"].Interface.L3.TC.Rate != 250 {
+			t.Errorf("TestCase: %s\n Got : defaults or profile modified\n Want: unchanged", testCase.caseDescription)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// RefCounter - tracks which running domains use each shared device, state is persisted as one JSON file per device
+//
+// RefCounter does no locking, callers serialize access per device with Lock.
+type RefCounter struct {
+	Dir string
+}
+
+// refCountState - persisted state of shared device
+type refCountState struct {
+	Users []string `json:"Users"`
+}
+
+// path - path to state file for device
+func (r RefCounter) path(dev string) string {
+	return filepath.Join(filepath.Clean(r.Dir), SanitizeInput(dev)+".json")
+}
+
+// Users - returns sorted list of users of device
+func (r RefCounter) Users(dev string) ([]string, error) {
+	// prefix for errors logging
+	const errPrefix = "refcount error:"
+
+	data, err := os.ReadFile(r.path(dev))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s %s", errPrefix, err)
+	}
+
+	var state refCountState
+
+	err = json.Unmarshal(data, &state)
+	if err != nil {
+		return nil, fmt.Errorf("%s '%s': %s", errPrefix, r.path(dev), err)
+	}
+
+	return state.Users, nil
+}
+
+// Devices - returns sorted list of devices with users
+func (r RefCounter) Devices() ([]string, error) {
+	// prefix for errors logging
+	const errPrefix = "refcount error:"
+
+	paths, err := filepath.Glob(filepath.Join(filepath.Clean(r.Dir), "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("%s %s", errPrefix, err)
+	}
+
+	devices := make([]string, 0, len(paths))
+	for _, path := range paths {
+		devices = append(devices, strings.TrimSuffix(filepath.Base(path), ".json"))
+	}
+
+	sort.Strings(devices)
+
+	return devices, nil
+}
+
+// save - persists users of device, removes state file when there are no users left
+func (r RefCounter) save(dev string, users []string) error {
+	// prefix for errors logging
+	const errPrefix = "refcount error:"
+
+	if len(users) == 0 {
+		err := os.Remove(r.path(dev))
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("%s %s", errPrefix, err)
+		}
+
+		return nil
+	}
+
+	sort.Strings(users)
+
+	data, err := json.Marshal(refCountState{Users: users})
+	if err != nil {
+		return fmt.Errorf("%s %s", errPrefix, err)
+	}
+
+	err = os.MkdirAll(filepath.Clean(r.Dir), 0755)
+	if err != nil {
+		return fmt.Errorf("%s %s", errPrefix, err)
+	}
+
+	err = WriteFileAtomic(r.path(dev), data, 0644)
+	if err != nil {
+		return fmt.Errorf("%s %s", errPrefix, err)
+	}
+
+	return nil
+}
+
+// Acquire - registers user of device, reports whether it is the first user
+func (r RefCounter) Acquire(dev, user string) (bool, error) {
+	users, err := r.Users(dev)
+	if err != nil {
+		return false, err
+	}
+
+	for _, u := range users {
+		if u == user {
+			return false, nil
+		}
+	}
+
+	err = r.save(dev, append(users, user))
+	if err != nil {
+		return false, err
+	}
+
+	return len(users) == 0, nil
+}
+
+// Release - unregisters user of device, reports whether it was the last user
+func (r RefCounter) Release(dev, user string) (bool, error) {
+	users, err := r.Users(dev)
+	if err != nil {
+		return false, err
+	}
+
+	// declare variable for remaining users
+	remaining := make([]string, 0, len(users))
+
+	for _, u := range users {
+		if u != user {
+			remaining = append(remaining, u)
+		}
+	}
+
+	// user is not registered, nothing changes
+	if len(remaining) == len(users) {
+		return false, nil
+	}
+
+	err = r.save(dev, remaining)
+	if err != nil {
+		return false, err
+	}
+
+	return len(remaining) == 0, nil
+}
+
+// WriteFileAtomic - writes file via temporary file and rename, so readers never observe partial content
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	// cleanup on failure, no-op after successful rename
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+
+	_, err = tmp.Write(data)
+	if err != nil {
+		_ = tmp.Close()
+
+		return err
+	}
+
+	err = tmp.Sync()
+	if err != nil {
+		_ = tmp.Close()
+
+		return err
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	err = os.Chmod(tmp.Name(), perm)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRefCounter(t *testing.T) {
+	r := RefCounter{Dir: t.TempDir()}
+
+	steps := []struct {
+		caseDescription string
+		release         bool
+		user            string
+		edge            bool // out, first on acquire or last on release
+		users           []string
+	}{
+		{"first user acquires", false, "vm1", true, []string{"vm1"}},
+		{"second user acquires", false, "vm2", false, []string{"vm1", "vm2"}},
+		{"repeated acquire is no-op", false, "vm1", false, []string{"vm1", "vm2"}},
+		{"unknown user release is no-op", true, "vm3", false, []string{"vm1", "vm2"}},
+		{"first user releases", true, "vm1", false, []string{"vm2"}},
+		{"last user releases", true, "vm2", true, nil},
+		{"repeated release is no-op", true, "vm2", false, nil},
+		{"device is reused", false, "vm3", true, []string{"vm3"}},
+	}
+
+	for _, step := range steps {
+		var (
+			edge bool
+			err  error
+		)
+
+		if step.release {
+			edge, err = r.Release("x-42", step.user)
+		} else {
+			edge, err = r.Acquire("x-42", step.user)
+		}
+
+		if err != nil {
+			t.Fatalf("TestCase: %s\n Got : %s\n Want: nil", step.caseDescription, err)
+		}
+
+		if edge != step.edge {
+			t.Errorf("TestCase: %s\n Got : %t\n Want: %t\n", step.caseDescription, edge, step.edge)
+		}
+
+		users, err := r.Users("x-42")
+		if err != nil {
+			t.Fatalf("TestCase: %s\n Got : %s\n Want: nil", step.caseDescription, err)
+		}
+
+		if !reflect.DeepEqual(users, step.users) {
+			t.Errorf("TestCase: %s\n Got : %v\n Want: %v\n", step.caseDescription, users, step.users)
+		}
+	}
+
+	// other devices are tracked independently
+	users, err := r.Users("x-43")
+	if err != nil || users != nil {
+		t.Errorf("Got : %v, %v\n Want: [], nil", users, err)
+	}
+}
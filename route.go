@@ -0,0 +1,265 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+
+	validator "gopkg.in/go-playground/validator.v9"
+)
+
+// onLinkPrefixLength - length of IPv6 on-link prefix of VM
+const onLinkPrefixLength = 64
+
+// IsNetworkPrefix - reports whether prefix is network address with prefix length, host bits must be zero
+func IsNetworkPrefix(prefix string) bool {
+	ip, network, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return false
+	}
+
+	return ip.Equal(network.IP)
+}
+
+// prefixLength - prefix length of CIDR, -1 for invalid one
+func prefixLength(prefix string) int {
+	_, network, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return -1
+	}
+
+	ones, _ := network.Mask.Size()
+
+	return ones
+}
+
+// ValidateL3Routes - struct level validation of L3, routed prefixes must be network addresses and be routed via VM address
+func ValidateL3Routes(sl validator.StructLevel) {
+	l3 := sl.Current().Interface().(L3)
+
+	for i, route := range l3.Routes {
+		if route.Prefix != "" && !IsNetworkPrefix(route.Prefix) {
+			sl.ReportError(route.Prefix, fmt.Sprintf("Routes[%d].Prefix", i), "Prefix", "network", "")
+		}
+
+		if route.Via != "" && !hasIP(l3.IPv4, route.Via) {
+			sl.ReportError(route.Via, fmt.Sprintf("Routes[%d].Via", i), "Via", "vmIPv4", "")
+		}
+	}
+
+	if l3.IPv6Prefix != "" && (!IsNetworkPrefix(l3.IPv6Prefix) || prefixLength(l3.IPv6Prefix) != onLinkPrefixLength) {
+		sl.ReportError(l3.IPv6Prefix, "IPv6Prefix", "IPv6Prefix", "prefix64", "")
+	}
+
+	for i, route := range l3.IPv6Delegated {
+		if route.Prefix != "" && (!IsNetworkPrefix(route.Prefix) || prefixLength(route.Prefix) > onLinkPrefixLength) {
+			sl.ReportError(route.Prefix, fmt.Sprintf("IPv6Delegated[%d].Prefix", i), "Prefix", "delegated", "")
+		}
+
+		if route.Via != "" && !hasIP(l3.IPv6, route.Via) && !inPrefix(l3.IPv6Prefix, route.Via) {
+			sl.ReportError(route.Via, fmt.Sprintf("IPv6Delegated[%d].Via", i), "Via", "vmIPv6", "")
+		}
+	}
+}
+
+// hasIP - reports whether address is in list, regardless of its notation
+func hasIP(list []string, ip string) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+
+	for _, item := range list {
+		if addr.Equal(net.ParseIP(item)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Addresses - IPv4 and IPv6 addresses of VM
+func (l *L3) Addresses() []string {
+	out := make([]string, 0, len(l.IPv4)+len(l.IPv6))
+	out = append(out, l.IPv4...)
+
+	return append(out, l.IPv6...)
+}
+
+// inPrefix - reports whether address belongs to prefix, empty prefix contains nothing
+func inPrefix(prefix string, ip string) bool {
+	_, network, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return false
+	}
+
+	addr := net.ParseIP(ip)
+
+	return addr != nil && network.Contains(addr)
+}
+
+// ownedPrefix - IPv6 address space routed to VM
+type ownedPrefix struct {
+	VM      string
+	Kind    string
+	Network *net.IPNet
+}
+
+// String - `IPv6Delegated 2a02:2278:200::/56 of VM 'vm1'`
+func (p ownedPrefix) String() string {
+	return fmt.Sprintf("%s %s of VM '%s'", p.Kind, p.Network, p.VM)
+}
+
+// ipv6Prefixes - IPv6 address space routed to VM: addresses as /128, on-link prefix and delegated prefixes
+func ipv6Prefixes(name string, vm VM) []ownedPrefix {
+	if vm.Interface == nil || vm.Interface.L3 == nil {
+		return nil
+	}
+
+	l3 := vm.Interface.L3
+
+	var out []ownedPrefix
+
+	add := func(kind, prefix string) {
+		_, network, err := net.ParseCIDR(prefix)
+		if err != nil {
+			return
+		}
+
+		out = append(out, ownedPrefix{VM: name, Kind: kind, Network: network})
+	}
+
+	for _, ip := range l3.IPv6 {
+		add("IPv6", ip+"/128")
+	}
+
+	if l3.IPv6Prefix != "" {
+		add("IPv6Prefix", l3.IPv6Prefix)
+	}
+
+	for _, route := range l3.IPv6Delegated {
+		add("IPv6Delegated", route.Prefix)
+	}
+
+	return out
+}
+
+// overlaps - reports whether one prefix contains other
+func overlaps(a, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
+
+// CheckIPv6Prefixes - ensures IPv6 address space of different VMs never overlaps, and delegated prefixes of VM overlap nothing else of it
+//
+// Addresses of VM may belong to its own on-link prefix, delegated prefixes are routed via VM and must be disjoint from everything else.
+func (c *Config) CheckIPv6Prefixes() error {
+	// sorted, so first error is stable
+	names := make([]string, 0, len(c.VMs))
+	for name := range c.VMs {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var all []ownedPrefix
+
+	for _, name := range names {
+		all = append(all, ipv6Prefixes(name, c.VMs[name])...)
+	}
+
+	for i, a := range all {
+		for _, b := range all[i+1:] {
+			if !overlaps(a.Network, b.Network) {
+				continue
+			}
+
+			// addresses of VM in its own on-link prefix
+			if a.VM == b.VM && a.Kind != "IPv6Delegated" && b.Kind != "IPv6Delegated" {
+				continue
+			}
+
+			// later prefix is located in config file
+			field := "VMs." + b.VM + ".Interface.L3." + b.Kind
+
+			if a.Network.String() == b.Network.String() {
+				return &FieldError{Field: field, Err: fmt.Errorf("%s overlaps %s", a, b)}
+			}
+
+			if a.Network.Contains(b.Network.IP) {
+				return &FieldError{Field: field, Err: fmt.Errorf("%s contains %s", a, b)}
+			}
+
+			return &FieldError{Field: field, Err: fmt.Errorf("%s contains %s", b, a)}
+		}
+	}
+
+	return nil
+}
+
+// AnnouncedPrefixes - prefixes routed to VM: addresses as host routes, routed IPv4 prefixes, on-link and delegated IPv6 prefixes
+func (l *L3) AnnouncedPrefixes() []string {
+	var out []string
+
+	for _, ip := range l.IPv4 {
+		out = append(out, ip+"/32")
+	}
+
+	for _, route := range l.Routes {
+		out = append(out, route.Prefix)
+	}
+
+	for _, ip := range l.IPv6 {
+		out = append(out, ip+"/128")
+	}
+
+	if l.IPv6Prefix != "" {
+		out = append(out, l.IPv6Prefix)
+	}
+
+	for _, route := range l.IPv6Delegated {
+		out = append(out, route.Prefix)
+	}
+
+	return out
+}
+
+// ProtocolArg - route protocol number, HookRouteProtocol when not set
+func (r Routing) ProtocolArg() string {
+	if r.Protocol == 0 {
+		return HookRouteProtocol
+	}
+
+	return strconv.FormatInt(r.Protocol, 10)
+}
+
+// MatchArgs - `ip route` arguments selecting hook route: protocol, table and metric
+func (r Routing) MatchArgs() []string {
+	args := []string{"proto", r.ProtocolArg()}
+
+	if r.Table != 0 {
+		args = append(args, "table", strconv.FormatInt(r.Table, 10))
+	}
+
+	if r.Metric != 0 {
+		args = append(args, "metric", strconv.FormatInt(r.Metric, 10))
+	}
+
+	return args
+}
+
+// AddArgs4 - `ip -4 route add` arguments of hook route, MatchArgs and realm
+func (r Routing) AddArgs4() []string {
+	args := r.MatchArgs()
+
+	if r.Realm != 0 {
+		args = append(args, "realm", strconv.FormatInt(r.Realm, 10))
+	}
+
+	return args
+}
+
+// AddArgs6 - `ip -6 route add` arguments of hook route, realm is IPv4 only
+func (r Routing) AddArgs6() []string {
+	return r.MatchArgs()
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	libvirtxml "github.com/libvirt/libvirt-go-xml"
+)
+
+func TestValidateL3Routes(t *testing.T) {
+	cases := []struct {
+		caseDescription string
+		routes          []Route
+		err             string
+	}{
+		{
+			caseDescription: "prefix via VM address",
+			routes:          []Route{{Prefix: "195.177.118.120/29", Via: "195.177.118.111"}},
+		},
+		{
+			caseDescription: "next hop is not VM address",
+			routes:          []Route{{Prefix: "195.177.118.120/29", Via: "195.177.118.112"}},
+			err:             "'L3.Routes[0].Via' Error:Field validation for 'Routes[0].Via' failed on the 'vmIPv4' tag",
+		},
+		{
+			caseDescription: "prefix with host bits set",
+			routes:          []Route{{Prefix: "195.177.118.121/29", Via: "195.177.118.111"}},
+			err:             "'L3.Routes[0].Prefix' Error:Field validation for 'Routes[0].Prefix' failed on the 'network' tag",
+		},
+		{
+			caseDescription: "IPv6 prefix",
+			routes:          []Route{{Prefix: "2a02:2278:100:1::/64", Via: "195.177.118.111"}},
+			err:             "failed on the 'cidrv4' tag",
+		},
+		{
+			caseDescription: "duplicate route",
+			routes: []Route{
+				{Prefix: "195.177.118.120/29", Via: "195.177.118.111"},
+				{Prefix: "195.177.118.120/29", Via: "195.177.118.111"},
+			},
+			err: "failed on the 'unique' tag",
+		},
+	}
+
+	for _, testCase := range cases {
+		l3 := L3{
+			Upper:  &Iface{"vu-9a0101"},
+			Source: &Iface{"vl-9a0101"},
+			Target: &Iface{"if-9a0101"},
+			TC:     &TC{Rate: 250, Burst: 256, Limit: 10240},
+			IPv4:   []string{"195.177.118.111"},
+			Routes: testCase.routes,
+		}
+
+		err := Validate.Struct(l3)
+		if testCase.err == "" {
+			if err != nil {
+				t.Errorf("TestCase: %s\n Got : %s\n Want: nil\n", testCase.caseDescription, err)
+			}
+
+			continue
+		}
+
+		if err == nil || !strings.Contains(err.Error(), testCase.err) {
+			t.Errorf("TestCase: %s\n Got : %v\n Want: %s\n", testCase.caseDescription, err, testCase.err)
+		}
+	}
+}
+
+func TestValidateL3IPv6Prefixes(t *testing.T) {
+	cases := []struct {
+		caseDescription string
+		prefix          string
+		delegated       []Route6
+		err             string
+	}{
+		{
+			caseDescription: "on-link prefix and delegation via address in it",
+			prefix:          "2a02:2278:100:1::/64",
+			delegated:       []Route6{{Prefix: "2a02:2278:200::/56", Via: "2a02:2278:100:1::2"}},
+		},
+		{
+			caseDescription: "delegation via VM address without on-link prefix",
+			delegated:       []Route6{{Prefix: "2a02:2278:200::/48", Via: "2a02:2278:100:1::1"}},
+		},
+		{
+			caseDescription: "on-link prefix is not /64",
+			prefix:          "2a02:2278:100::/56",
+			err:             "failed on the 'prefix64' tag",
+		},
+		{
+			caseDescription: "on-link prefix with host bits set",
+			prefix:          "2a02:2278:100:1::1/64",
+			err:             "failed on the 'prefix64' tag",
+		},
+		{
+			caseDescription: "delegated prefix longer than /64",
+			delegated:       []Route6{{Prefix: "2a02:2278:200::/80", Via: "2a02:2278:100:1::1"}},
+			err:             "'L3.IPv6Delegated[0].Prefix' Error:Field validation for 'IPv6Delegated[0].Prefix' failed on the 'delegated' tag",
+		},
+		{
+			caseDescription: "next hop is not VM address",
+			prefix:          "2a02:2278:100:1::/64",
+			delegated:       []Route6{{Prefix: "2a02:2278:200::/56", Via: "2a02:2278:100:2::1"}},
+			err:             "'L3.IPv6Delegated[0].Via' Error:Field validation for 'IPv6Delegated[0].Via' failed on the 'vmIPv6' tag",
+		},
+	}
+
+	for _, testCase := range cases {
+		l3 := L3{
+			Upper:         &Iface{"vu-9a0101"},
+			Source:        &Iface{"vl-9a0101"},
+			Target:        &Iface{"if-9a0101"},
+			TC:            &TC{Rate: 250, Burst: 256, Limit: 10240},
+			IPv4:          []string{"195.177.118.111"},
+			IPv6:          []string{"2a02:2278:100:1::1"},
+			IPv6Prefix:    testCase.prefix,
+			IPv6Delegated: testCase.delegated,
+		}
+
+		err := Validate.Struct(l3)
+		if testCase.err == "" {
+			if err != nil {
+				t.Errorf("TestCase: %s\n Got : %s\n Want: nil\n", testCase.caseDescription, err)
+			}
+
+			continue
+		}
+
+		if err == nil || !strings.Contains(err.Error(), testCase.err) {
+			t.Errorf("TestCase: %s\n Got : %v\n Want: %s\n", testCase.caseDescription, err, testCase.err)
+		}
+	}
+}
+
+func TestCheckIPv6Prefixes(t *testing.T) {
+	vm := func(ipv6 []string, prefix string, delegated ...Route6) VM {
+		return VM{Interface: &Interface{L3: &L3{IPv6: ipv6, IPv6Prefix: prefix, IPv6Delegated: delegated}}}
+	}
+
+	cases := []struct {
+		caseDescription string
+		vms             map[string]VM
+		err             string
+	}{
+		{
+			caseDescription: "disjoint VMs, address in own on-link prefix",
+			vms: map[string]VM{
+				"vm1": vm([]string{"2a02:2278:100:1::1"}, "2a02:2278:100:1::/64", Route6{"2a02:2278:200::/56", "2a02:2278:100:1::1"}),
+				"vm2": vm([]string{"2a02:2278:100:2::1"}, "2a02:2278:100:2::/64", Route6{"2a02:2278:200:100::/56", "2a02:2278:100:2::1"}),
+			},
+		},
+		{
+			caseDescription: "same on-link prefix",
+			vms: map[string]VM{
+				"vm1": vm(nil, "2a02:2278:100:1::/64"),
+				"vm2": vm(nil, "2a02:2278:100:1::/64"),
+			},
+			err: "IPv6Prefix 2a02:2278:100:1::/64 of VM 'vm1' overlaps IPv6Prefix 2a02:2278:100:1::/64 of VM 'vm2'",
+		},
+		{
+			caseDescription: "address of other VM in on-link prefix",
+			vms: map[string]VM{
+				"vm1": vm(nil, "2a02:2278:100:1::/64"),
+				"vm2": vm([]string{"2a02:2278:100:1::2"}, ""),
+			},
+			err: "IPv6Prefix 2a02:2278:100:1::/64 of VM 'vm1' contains IPv6 2a02:2278:100:1::2/128 of VM 'vm2'",
+		},
+		{
+			caseDescription: "delegated prefix contains on-link prefix of other VM",
+			vms: map[string]VM{
+				"vm1": vm([]string{"2a02:2278:100:1::1"}, "", Route6{"2a02:2278:200::/48", "2a02:2278:100:1::1"}),
+				"vm2": vm(nil, "2a02:2278:200:1::/64"),
+			},
+			err: "IPv6Delegated 2a02:2278:200::/48 of VM 'vm1' contains IPv6Prefix 2a02:2278:200:1::/64 of VM 'vm2'",
+		},
+		{
+			caseDescription: "delegated prefix contains own on-link prefix",
+			vms: map[string]VM{
+				"vm1": vm(nil, "2a02:2278:100:1::/64", Route6{"2a02:2278:100::/56", "2a02:2278:100:1::1"}),
+			},
+			err: "IPv6Delegated 2a02:2278:100::/56 of VM 'vm1' contains IPv6Prefix 2a02:2278:100:1::/64 of VM 'vm1'",
+		},
+	}
+
+	for _, testCase := range cases {
+		cfg := &Config{VMs: testCase.vms}
+
+		err := cfg.CheckIPv6Prefixes()
+		if testCase.err == "" {
+			if err != nil {
+				t.Errorf("TestCase: %s\n Got : %s\n Want: nil\n", testCase.caseDescription, err)
+			}
+
+			continue
+		}
+
+		if err == nil || err.Error() != testCase.err {
+			t.Errorf("TestCase: %s\n Got : %v\n Want: %s\n", testCase.caseDescription, err, testCase.err)
+		}
+	}
+}
+
+func TestHookRouting(t *testing.T) {
+	cases := []struct {
+		caseDescription string
+		routing         *Routing
+		want            []string
+	}{
+		{
+			caseDescription: "default protocol in main table",
+			want: []string{
+				"ip -4 route add 195.177.118.111/32 dev vu-9a0101 proto 220",
+				"ip -4 route add 195.177.118.120/29 via 195.177.118.111 dev vu-9a0101 proto 220",
+				"ip -6 route add 2a02:2278:100:1::/64 dev vu-9a0101 proto 220",
+				"ip -6 route del 2a02:2278:100:1::/64 dev vu-9a0101 proto 220",
+				"ip -4 route del 195.177.118.120/29 via 195.177.118.111 dev vu-9a0101 proto 220",
+			},
+		},
+		{
+			caseDescription: "configured protocol, table, metric and IPv4 only realm",
+			routing:         &Routing{Protocol: 201, Table: 100, Metric: 512, Realm: 7},
+			want: []string{
+				"ip -4 route add 195.177.118.111/32 dev vu-9a0101 proto 201 table 100 metric 512 realm 7",
+				"ip -4 route add 195.177.118.120/29 via 195.177.118.111 dev vu-9a0101 proto 201 table 100 metric 512 realm 7",
+				"ip -6 route add 2a02:2278:100:1::/64 dev vu-9a0101 proto 201 table 100 metric 512",
+				"ip -6 route del 2a02:2278:100:1::/64 dev vu-9a0101 proto 201 table 100 metric 512",
+				"ip -4 route del 195.177.118.120/29 via 195.177.118.111 dev vu-9a0101 proto 201 table 100 metric 512",
+			},
+		},
+	}
+
+	for _, testCase := range cases {
+		cfg := &Config{
+			Routing: testCase.routing,
+			VMs: map[string]VM{
+				"vm1": {Interface: &Interface{
+					Uplink: &Iface{"bond-wan"},
+					L3: &L3{
+						Upper:      &Iface{"vu-9a0101"},
+						Source:     &Iface{"vl-9a0101"},
+						Target:     &Iface{"if-9a0101"},
+						TC:         &TC{Rate: 250, Burst: 256, Limit: 10240},
+						IPv4:       []string{"195.177.118.111"},
+						Routes:     []Route{{Prefix: "195.177.118.120/29", Via: "195.177.118.111"}},
+						IPv6Prefix: "2a02:2278:100:1::/64",
+					},
+				}},
+			},
+		}
+
+		s, r := NewRecordingSystem(t)
+		domCfg := &libvirtxml.Domain{Name: "vm1", UUID: "8b5c4a64-4c44-4c4e-9d2d-4f7a1b7e0a01"}
+
+		err := cfg.PrepareBeginHook(s, domCfg)
+		if err == nil {
+			err = cfg.StoppedEndHook(s, domCfg)
+		}
+
+		if err != nil {
+			t.Fatalf("TestCase: %s\n Got : %s\n Want: nil", testCase.caseDescription, err)
+		}
+
+		ops := strings.Join(r.Ops, "\n") + "\n"
+
+		for _, op := range testCase.want {
+			if !strings.Contains(ops, op+"\n") {
+				t.Errorf("TestCase: %s\n Got :\n%s\n Want: %s\n", testCase.caseDescription, ops, op)
+			}
+		}
+	}
+}
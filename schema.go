@@ -0,0 +1,464 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// SchemaDialect - JSON Schema dialect of generated schema
+const SchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// JSONSchema - subset of JSON Schema keywords needed to describe config
+type JSONSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	Title                string                 `json:"title,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Ref                  string                 `json:"$ref,omitempty"`
+	Type                 string                 `json:"type,omitempty"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties any                    `json:"additionalProperties,omitempty"`
+	MinProperties        *int64                 `json:"minProperties,omitempty"`
+	MaxProperties        *int64                 `json:"maxProperties,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+	MinItems             *int64                 `json:"minItems,omitempty"`
+	MaxItems             *int64                 `json:"maxItems,omitempty"`
+	UniqueItems          bool                   `json:"uniqueItems,omitempty"`
+	Minimum              *int64                 `json:"minimum,omitempty"`
+	Maximum              *int64                 `json:"maximum,omitempty"`
+	MinLength            *int64                 `json:"minLength,omitempty"`
+	MaxLength            *int64                 `json:"maxLength,omitempty"`
+	Pattern              string                 `json:"pattern,omitempty"`
+	Format               string                 `json:"format,omitempty"`
+	Enum                 []string               `json:"enum,omitempty"`
+	Const                any                    `json:"const,omitempty"`
+	Not                  *JSONSchema            `json:"not,omitempty"`
+	AnyOf                []*JSONSchema          `json:"anyOf,omitempty"`
+	Defs                 map[string]*JSONSchema `json:"$defs,omitempty"`
+}
+
+// schemaDescriptions - descriptions of config fields, keyed by `Type.Field`, units are not visible in validate tags
+var schemaDescriptions = map[string]string{
+	"Config":                 "libvirt qemu hook config",
+	"Config.Defaults":        "partial VM config inherited by every VM",
+	"Config.Profiles":        "named partial VM configs, referenced by VM Profile",
+	"VM.Profile":             "name of profile, applied over Defaults and overridden by host section and VM",
+	"Config.Naming":          "templates of interface names derived from domain UUID, used for omitted names",
+	"Naming.Upper":           "upper peer of veth pair, `{uuid:N}` and `{hash:N}` placeholders, defaults to `vu-{hash:12}`",
+	"Naming.Source":          "lower peer of veth pair, `{uuid:N}` and `{hash:N}` placeholders, defaults to `vl-{hash:12}`",
+	"Naming.Target":          "L3 tap, `{uuid:N}` and `{hash:N}` placeholders, defaults to `if-{hash:12}`",
+	"Naming.VxLAN":           "VxLAN tap, `{uuid:N}` and `{hash:N}` placeholders, defaults to `vx-{hash:12}`",
+	"L3.NIC":                 "binds Target to domain interface, tap name is taken from domain XML",
+	"VxLAN.NIC":              "binds Target to domain interface, tap name is taken from domain XML",
+	"NIC.MAC":                "MAC address of domain interface",
+	"NIC.Alias":              "alias of domain interface, e.g. `ua-wan`",
+	"VM.Match":               "selects domains by pattern or label, for VMs not keyed by domain UUID or name",
+	"Match.Name":             "shell glob on domain name, e.g. `ci-runner-*`",
+	"Match.NameRegex":        "regular expression on whole domain name",
+	"Match.MAC":              "MAC address of any domain interface",
+	"Match.Title":            "shell glob on domain title",
+	"Match.Label":            "label in hook namespace of domain metadata",
+	"Config.Hosts":           "per-host overrides and VMs, section matching current host is applied",
+	"HostSection":            "config for hosts selected by hostname or machine-id, all set selectors must match",
+	"HostSection.Hostname":   "shell glob on hostname, e.g. `hv-fra-*`",
+	"HostSection.MachineID":  "content of /etc/machine-id",
+	"HostSection.Uplink":     "uplink of host, overrides Defaults and profiles",
+	"HostSection.VxLANLocal": "local address of VxLAN tunnels, overrides Defaults and profiles",
+	"HostSection.TC":         "traffic control of L3 and VxLAN taps, overrides Defaults and profiles",
+	"HostSection.VMs":        "VMs defined only on selected hosts",
+	"VxLAN.Local":            "local address of VxLAN tunnel, usually set per host",
+	"Config.VMs":             "config per VM, keyed by domain name, may be defined in drop-in files",
+	"Config.Timeouts":        "limits for external commands and hook invocation, defaults are used for missing values",
+	"Config.Log":             "logging configuration",
+	"Interface.Uplink":       "uplink of host node",
+	"Interface.VxLAN":        "private LAN configuration",
+	"Interface.L3":           "Internet configuration",
+	"VM.Interface":           "interfaces of VM",
+	"VxLAN.VNI":              "VxLAN network identifier",
+	"VxLAN.Source":           "shared VxLAN link, usually on uplink",
+	"VxLAN.Target":           "tap created by libvirt",
+	"VxLAN.TC":               "traffic control of VxLAN tap",
+	"L3.Upper":               "upper peer of veth pair",
+	"L3.Source":              "lower peer of veth pair",
+	"L3.Target":              "tap created by libvirt",
+	"L3.IPv4":                "addresses of VM, routed as /32 to upper peer of veth pair",
+	"L3.TC":                  "traffic control of L3 tap",
+	"L3.IPv6":                "addresses must not be network address of their /64, unless Gateway.IPv6 is `link-local`",
+	"L3.Routes":              "IPv4 prefixes routed via VM address, e.g. subnet of router inside VM",
+	"Route.Prefix":           "network address with prefix length, host bits must be zero",
+	"Route.Via":              "next hop, one of VM IPv4 addresses",
+	"L3.IPv6Prefix":          "on-link /64 routed to upper peer of veth pair, its network address is gateway of VM",
+	"L3.IPv6Delegated":       "IPv6 prefixes delegated to VM, e.g. /56 or /48, routed via VM address",
+	"L3.Gateway":             "gateway models of VM, `proxy-arp` for IPv4 and `network` for IPv6 when omitted",
+	"Gateway.IPv4":           "`proxy-arp`: upper peer answers ARP for every address, `link-local`: VM uses 169.254.0.1 answered by proxy ARP entry on upper peer",
+	"Gateway.IPv6":           "`network`: VM uses network address of its /64 on upper peer, `link-local`: VM uses fe80::1 on upper peer",
+	"L3.ProxyNeighbors":      "`uplink`: proxy ARP/NDP entry for each VM address on Uplink, for on-link provider networks, `none` by default",
+	"L3.Announce":            "gratuitous ARP and unsolicited NA for VM addresses out of Uplink after start, not sent when omitted",
+	"Announce.Count":         "rounds, every round announces each address once, defaults to 3",
+	"Announce.Interval":      "milliseconds between rounds, defaults to 1000",
+	"Config.Routing":         "attributes of every route installed by hook, so routing daemons can redistribute VM routes",
+	"Routing.Protocol":       "route protocol number, see /etc/iproute2/rt_protos, defaults to 220",
+	"Routing.Table":          "routing table number, defaults to main table",
+	"Routing.Metric":         "route metric, kernel default when omitted",
+	"Routing.Realm":          "route realm of IPv4 routes, IPv6 routes carry no realm, see /etc/iproute2/rt_realms",
+	"Config.BGP":             "announcement of VM routes to peers by `qemu bgp` daemon, disabled when omitted",
+	"HostSection.BGP":        "BGP settings of host, e.g. RouterID, override top-level BGP field by field",
+	"BGP.ASN":                "local AS number",
+	"BGP.RouterID":           "BGP identifier of host node",
+	"BGP.HoldTime":           "seconds, defaults to 90",
+	"BGP.NextHop4":           "next hop of IPv4 routes, defaults to local address of IPv4 session",
+	"BGP.NextHop6":           "next hop of IPv6 routes, defaults to local address of IPv6 session",
+	"BGP.Peers":              "BGP neighbors, e.g. top-of-rack routers",
+	"BGPPeer.Address":        "address of neighbor",
+	"BGPPeer.ASN":            "remote AS number, same as local one for iBGP",
+	"BGPPeer.Port":           "TCP port, defaults to 179",
+	"Route6.Prefix":          "network address with prefix length, at most /64",
+	"Route6.Via":             "next hop, VM address in IPv6 or in IPv6Prefix",
+	"Iface.Name":             "interface name, up to 15 characters",
+	"TC.Rate":                "mbit",
+	"TC.Burst":               "kb",
+	"TC.Limit":               "packets",
+	"Timeouts.Command":       "seconds, per external command",
+	"Timeouts.Hook":          "seconds, per hook invocation",
+	"Timeouts.Retries":       "retries of transient command failures",
+	"Timeouts.Backoff":       "milliseconds, delay before first retry, doubled after each retry",
+	"Log.Sink":               "unavailable sink falls back to stderr",
+	"Log.Address":            "unix socket of syslog or journald sink",
+	"Log.Format":             "log line format",
+	"Log.Level":              "commands are logged on debug level",
+}
+
+// schemaGenerator - generates schema from struct types and their validate tags, structs are shared through `$defs`
+type schemaGenerator struct {
+	defs map[string]*JSONSchema
+}
+
+// NewConfigSchema - generates JSON Schema of config file from `Config` struct and its validate tags
+func NewConfigSchema() (*JSONSchema, error) {
+	g := schemaGenerator{defs: make(map[string]*JSONSchema)}
+
+	root, err := g.structSchema(reflect.TypeOf(Config{}), false)
+	if err != nil {
+		return nil, fmt.Errorf("schema error: %s", err)
+	}
+
+	root.Schema = SchemaDialect
+	root.Title = "qemu-hook config"
+	root.Defs = g.defs
+
+	// editors locate schema by `$schema` key, config decoding ignores it
+	root.Properties["$schema"] = &JSONSchema{Type: "string"}
+
+	// VMs may be defined only in drop-in files, merged config is checked at runtime
+	required := root.Required[:0]
+	for _, name := range root.Required {
+		if name != "VMs" {
+			required = append(required, name)
+		}
+	}
+
+	root.Required = required
+
+	return root, nil
+}
+
+// MarshalSchema - schema as indented JSON, as written to `qemu-hook.schema.json`
+func MarshalSchema(s *JSONSchema) ([]byte, error) {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(data, '\n'), nil
+}
+
+// typeSchema - schema of Go type, structs are referenced from `$defs`
+//
+// Partial structs, as used by `Defaults` and `Profiles`, have no required fields and are defined as `Partial<Name>`.
+func (g *schemaGenerator) typeSchema(t reflect.Type, partial bool) (*JSONSchema, error) {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return g.typeSchema(t.Elem(), partial)
+	case reflect.Struct:
+		name := t.Name()
+		if partial {
+			name = "Partial" + name
+		}
+
+		if _, ok := g.defs[name]; !ok {
+			// placeholder guards against recursive types
+			g.defs[name] = nil
+
+			s, err := g.structSchema(t, partial)
+			if err != nil {
+				return nil, err
+			}
+
+			g.defs[name] = s
+		}
+
+		return &JSONSchema{Ref: "#/$defs/" + name}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("unsupported map key type %s", t.Key())
+		}
+
+		elem, err := g.typeSchema(t.Elem(), partial)
+		if err != nil {
+			return nil, err
+		}
+
+		return &JSONSchema{Type: "object", AdditionalProperties: elem}, nil
+	case reflect.Slice:
+		elem, err := g.typeSchema(t.Elem(), partial)
+		if err != nil {
+			return nil, err
+		}
+
+		return &JSONSchema{Type: "array", Items: elem}, nil
+	case reflect.String:
+		return &JSONSchema{Type: "string"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &JSONSchema{Type: "integer"}, nil
+	case reflect.Bool:
+		return &JSONSchema{Type: "boolean"}, nil
+	default:
+		return nil, fmt.Errorf("unsupported type %s", t)
+	}
+}
+
+// structSchema - schema of struct, unknown fields are rejected to catch typos
+func (g *schemaGenerator) structSchema(t reflect.Type, partial bool) (*JSONSchema, error) {
+	s := &JSONSchema{
+		Description:          schemaDescriptions[t.Name()],
+		Type:                 "object",
+		Properties:           make(map[string]*JSONSchema),
+		AdditionalProperties: false,
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" || !f.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+
+		fs, required, err := g.fieldSchema(f, partial || f.Tag.Get("schema") == "partial")
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %s", t.Name(), f.Name, err)
+		}
+
+		if d := schemaDescriptions[t.Name()+"."+f.Name]; d != "" {
+			fs.Description = d
+		}
+
+		s.Properties[name] = fs
+
+		if required && !partial {
+			s.Required = append(s.Required, name)
+		}
+	}
+
+	return s, nil
+}
+
+// fieldSchema - schema of struct field with constraints of its validate tag, tags after `dive` apply to elements
+func (g *schemaGenerator) fieldSchema(f reflect.StructField, partial bool) (*JSONSchema, bool, error) {
+	s, err := g.typeSchema(f.Type, partial)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// `-` skips validation of field
+	tag := f.Tag.Get("validate")
+	if tag == "" || tag == "-" {
+		return s, false, nil
+	}
+
+	tags := strings.Split(tag, ",")
+
+	var elemTags []string
+
+	for i, t := range tags {
+		if t == "dive" {
+			tags, elemTags = tags[:i], tags[i+1:]
+
+			break
+		}
+	}
+
+	t := f.Type
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	required, err := applyValidateTags(s, t, tags)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if len(elemTags) != 0 {
+		var elem *JSONSchema
+
+		switch t.Kind() {
+		case reflect.Slice:
+			elem = s.Items
+		case reflect.Map:
+			elem, _ = s.AdditionalProperties.(*JSONSchema)
+		}
+
+		if elem == nil {
+			return nil, false, fmt.Errorf("'dive' on %s", t)
+		}
+
+		_, err = applyValidateTags(elem, t.Elem(), elemTags)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	return s, required, nil
+}
+
+// applyValidateTags - translates validate tags to schema keywords, reports whether value is required
+//
+// Validator skips remaining tags for zero value of `omitempty` scalar, so its constraints are relaxed to `anyOf` zero value.
+func applyValidateTags(s *JSONSchema, t reflect.Type, tags []string) (bool, error) {
+	var required, omitempty bool
+
+	for _, tag := range tags {
+		switch tag {
+		case "required":
+			required = true
+		case "omitempty":
+			omitempty = true
+		}
+	}
+
+	target := s
+
+	isScalar := t.Kind() != reflect.Struct && t.Kind() != reflect.Slice && t.Kind() != reflect.Map
+	if omitempty && isScalar {
+		target = new(JSONSchema)
+	}
+
+	for _, tag := range tags {
+		name, param, _ := strings.Cut(tag, "=")
+
+		switch name {
+		case "", "omitempty":
+		case "required":
+			// non-empty string, zero numbers are excluded by min
+			if t.Kind() == reflect.String {
+				target.MinLength = schemaInt(1)
+			}
+		case "min", "max":
+			n, err := strconv.ParseInt(param, 10, 64)
+			if err != nil {
+				return false, fmt.Errorf("invalid '%s' param: %s", tag, err)
+			}
+
+			applyBound(target, t.Kind(), name == "min", n)
+		case "len":
+			n, err := strconv.ParseInt(param, 10, 64)
+			if err != nil {
+				return false, fmt.Errorf("invalid '%s' param: %s", tag, err)
+			}
+
+			applyBound(target, t.Kind(), true, n)
+			applyBound(target, t.Kind(), false, n)
+		case "ne":
+			n, err := strconv.ParseInt(param, 10, 64)
+			if err != nil {
+				return false, fmt.Errorf("invalid '%s' param: %s", tag, err)
+			}
+
+			target.Not = &JSONSchema{Const: n}
+		case "unique":
+			target.UniqueItems = true
+		case "ipv4", "ipv6":
+			target.Format = name
+		case "ip":
+			// IPv4 or IPv6, JSON Schema has no format for both
+		case "cidrv4":
+			target.Pattern = `^([0-9]{1,3}\.){3}[0-9]{1,3}/[0-9]{1,2}$`
+		case "cidrv6":
+			target.Pattern = `^[0-9a-fA-F:.]+/[0-9]{1,3}$`
+		case "hexadecimal":
+			target.Pattern = "^(0[xX])?[0-9a-fA-F]+$"
+		case "oneof":
+			target.Enum = strings.Fields(param)
+		case "iface":
+			target.Pattern = "^[a-zA-Z0-9-]{1,15}$"
+		case "required_without":
+			// one of sibling fields, VM fields are never required by schema
+		case "mac":
+			target.Pattern = "^([0-9A-Fa-f]{2}[:-]){5}[0-9A-Fa-f]{2}$"
+		case "glob":
+			// syntax is checked by `qemu validate`
+		case "regexp":
+			target.Format = "regex"
+		case "ifaceTemplate":
+			target.Pattern = `^[a-zA-Z0-9-]*(\{(uuid|hash):[0-9]+\}[a-zA-Z0-9-]*)+$`
+		case "notGW6":
+			// depends on gateway model of VM, checked by `qemu validate`
+		case "filepath":
+			// any string is a path, validator only rejects directories
+		default:
+			return false, fmt.Errorf("unsupported validate tag '%s'", tag)
+		}
+	}
+
+	if target != s && !reflect.DeepEqual(*target, JSONSchema{}) {
+		s.AnyOf = []*JSONSchema{
+			{Const: reflect.Zero(t).Interface()},
+			target,
+		}
+	}
+
+	return required, nil
+}
+
+// applyBound - `min`/`max` bound value of numbers, length of strings, count of items
+func applyBound(s *JSONSchema, kind reflect.Kind, isMin bool, n int64) {
+	switch kind {
+	case reflect.String:
+		if isMin {
+			s.MinLength = schemaInt(n)
+		} else {
+			s.MaxLength = schemaInt(n)
+		}
+	case reflect.Slice:
+		if isMin {
+			s.MinItems = schemaInt(n)
+		} else {
+			s.MaxItems = schemaInt(n)
+		}
+	case reflect.Map:
+		if isMin {
+			s.MinProperties = schemaInt(n)
+		} else {
+			s.MaxProperties = schemaInt(n)
+		}
+	default:
+		if isMin {
+			s.Minimum = schemaInt(n)
+		} else {
+			s.Maximum = schemaInt(n)
+		}
+	}
+}
+
+// schemaInt - pointer to integer keyword value
+func schemaInt(n int64) *int64 {
+	return &n
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// schemaPath - committed schema, regenerate with `go test -run TestConfigSchema -update`
+const schemaPath = "qemu-hook.schema.json"
+
+func TestConfigSchema(t *testing.T) {
+	schema, err := NewConfigSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := MarshalSchema(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *update {
+		err = os.WriteFile(schemaPath, got, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want, err := os.ReadFile(schemaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, want) {
+		t.Errorf("TestCase: %s is out of sync with config structs, regenerate it with `go test -run TestConfigSchema -update`", schemaPath)
+	}
+}
+
+func TestApplyValidateTags(t *testing.T) {
+	cases := []struct {
+		caseDescription string
+		value           any
+		tags            string
+		want            JSONSchema
+		required        bool
+		err             string
+	}{
+		{
+			caseDescription: "required integer with range",
+			value:           int64(0),
+			tags:            "required,min=1,max=16777214",
+			want:            JSONSchema{Minimum: schemaInt(1), Maximum: schemaInt(16777214)},
+			required:        true,
+		},
+		{
+			caseDescription: "optional integer allows zero value",
+			value:           int64(0),
+			tags:            "omitempty,min=1",
+			want:            JSONSchema{AnyOf: []*JSONSchema{{Const: int64(0)}, {Minimum: schemaInt(1)}}},
+		},
+		{
+			caseDescription: "required string",
+			value:           "",
+			tags:            "required,iface",
+			want:            JSONSchema{MinLength: schemaInt(1), Pattern: "^[a-zA-Z0-9-]{1,15}$"},
+			required:        true,
+		},
+		{
+			caseDescription: "optional enum",
+			value:           "",
+			tags:            "omitempty,oneof=text json",
+			want:            JSONSchema{AnyOf: []*JSONSchema{{Const: ""}, {Enum: []string{"text", "json"}}}},
+		},
+		{
+			caseDescription: "unique items",
+			value:           []string{},
+			tags:            "unique,min=1",
+			want:            JSONSchema{UniqueItems: true, MinItems: schemaInt(1)},
+		},
+		{
+			caseDescription: "IPv6 not network address, depends on gateway model",
+			value:           "",
+			tags:            "ipv6,notGW6",
+			want:            JSONSchema{Format: "ipv6"},
+		},
+		{
+			caseDescription: "unsupported tag",
+			value:           "",
+			tags:            "email",
+			err:             "unsupported validate tag 'email'",
+		},
+	}
+
+	for _, testCase := range cases {
+		var got JSONSchema
+
+		required, err := applyValidateTags(&got, reflect.TypeOf(testCase.value), strings.Split(testCase.tags, ","))
+		if testCase.err != "" {
+			if err == nil || !strings.Contains(err.Error(), testCase.err) {
+				t.Errorf("TestCase: %s\n Got : %v\n Want: %s\n", testCase.caseDescription, err, testCase.err)
+			}
+
+			continue
+		}
+
+		if err != nil || required != testCase.required || !reflect.DeepEqual(got, testCase.want) {
+			t.Errorf("TestCase: %s\n Got : %+v, %v, %v\n Want: %+v, %v\n", testCase.caseDescription, got, required, err, testCase.want, testCase.required)
+		}
+	}
+}
+
+// configFields - `Type` and `Type.Field` keys of config types reachable from `Config`, for fields visible in config file
+func configFields(t reflect.Type, out map[string]bool) {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map:
+		configFields(t.Elem(), out)
+
+		return
+	case reflect.Struct:
+	default:
+		return
+	}
+
+	if out[t.Name()] {
+		return
+	}
+
+	out[t.Name()] = true
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		if !f.IsExported() || strings.Split(f.Tag.Get("json"), ",")[0] == "-" {
+			continue
+		}
+
+		out[t.Name()+"."+f.Name] = true
+
+		configFields(f.Type, out)
+	}
+}
+
+func TestSchemaDescriptions(t *testing.T) {
+	fields := make(map[string]bool)
+	configFields(reflect.TypeOf(Config{}), fields)
+
+	// every field visible in config file is described
+	for key := range fields {
+		if strings.Contains(key, ".") && schemaDescriptions[key] == "" {
+			t.Errorf("TestCase: config field %s\n Got : no entry in schemaDescriptions\n Want: description", key)
+		}
+	}
+
+	// descriptions of removed or renamed fields are not kept
+	for key := range schemaDescriptions {
+		if !fields[key] {
+			t.Errorf("TestCase: schemaDescriptions entry %s\n Got : no such config type or field\n Want: entry removed", key)
+		}
+	}
+}
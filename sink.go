@@ -0,0 +1,348 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultSyslogAddress - default unix socket of syslog daemon
+const DefaultSyslogAddress = "/dev/log"
+
+// JournaldAddress - unix socket of journald native protocol
+const JournaldAddress = "/run/systemd/journal/socket"
+
+// syslogFacilityDaemon - syslog facility used for hook messages
+const syslogFacilityDaemon = 3
+
+// syslogSeverity - maps slog level to syslog severity
+func syslogSeverity(level slog.Level) int {
+	switch {
+	case level >= slog.LevelError:
+		return 3 // err
+	case level >= slog.LevelWarn:
+		return 4 // warning
+	case level >= slog.LevelInfo:
+		return 6 // info
+	default:
+		return 7 // debug
+	}
+}
+
+// OpenLogSink - opens configured log sink, falls back to stderr when sink is unavailable
+//
+// Returned closer must be closed on exit, returned error describes why sink fell back to stderr.
+func OpenLogSink(cfg *Log, path string) (*slog.Logger, io.Closer, error) {
+	if cfg == nil {
+		cfg = new(Log)
+	}
+
+	var (
+		logger *slog.Logger
+		closer io.Closer
+		err    error
+	)
+
+	switch strings.ToLower(cfg.Sink) {
+	case "stderr":
+		return NewLogger(os.Stderr, cfg), io.NopCloser(os.Stderr), nil
+	case "syslog":
+		logger, closer, err = openSyslogSink(cfg)
+	case "journald":
+		logger, closer, err = openJournaldSink(cfg)
+	default:
+		logger, closer, err = openFileSink(cfg, path)
+	}
+
+	if err != nil {
+		return NewLogger(os.Stderr, cfg), io.NopCloser(os.Stderr), fmt.Errorf("log sink error: falling back to stderr: %s", err)
+	}
+
+	return logger, closer, nil
+}
+
+// openFileSink - appends log lines to file, file is created when missing
+func openFileSink(cfg *Log, path string) (*slog.Logger, io.Closer, error) {
+	fd, err := os.OpenFile(filepath.Clean(path), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return NewLogger(fd, cfg), fd, nil
+}
+
+// dialUnix - connects to local datagram socket, falls back to stream socket
+func dialUnix(address string) (net.Conn, error) {
+	conn, err := net.Dial("unixgram", address)
+	if err == nil {
+		return conn, nil
+	}
+
+	return net.Dial("unix", address)
+}
+
+// levelWriter - writer which knows level of record being written, slog handlers write each record with single Write call
+type levelWriter struct {
+	mu    sync.Mutex
+	level slog.Level
+	write func(level slog.Level, p []byte) error
+}
+
+// Write - writes record with level set by levelHandler
+func (w *levelWriter) Write(p []byte) (int, error) {
+	err := w.write(w.level, bytes.TrimRight(p, "\n"))
+	if err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// levelHandler - passes record level to levelWriter
+type levelHandler struct {
+	slog.Handler
+	w *levelWriter
+}
+
+// Handle - sets record level on writer and handles record
+func (h levelHandler) Handle(ctx context.Context, r slog.Record) error {
+	h.w.mu.Lock()
+	defer h.w.mu.Unlock()
+
+	h.w.level = r.Level
+
+	return h.Handler.Handle(ctx, r)
+}
+
+// WithAttrs - returns handler with attributes
+func (h levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return levelHandler{Handler: h.Handler.WithAttrs(attrs), w: h.w}
+}
+
+// WithGroup - returns handler with group
+func (h levelHandler) WithGroup(name string) slog.Handler {
+	return levelHandler{Handler: h.Handler.WithGroup(name), w: h.w}
+}
+
+// FormatRFC5424 - formats syslog message: `<PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG`
+func FormatRFC5424(level slog.Level, t time.Time, hostname, app string, pid int, msg []byte) []byte {
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "<%d>1 %s %s %s %d - - ",
+		syslogFacilityDaemon*8+syslogSeverity(level),
+		t.Format(time.RFC3339Nano),
+		rfc5424Field(hostname),
+		rfc5424Field(app),
+		pid,
+	)
+
+	b.Write(msg)
+
+	return b.Bytes()
+}
+
+// rfc5424Field - header fields are printable US-ASCII without spaces, `-` is nil value
+func rfc5424Field(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return -1
+		}
+
+		return r
+	}, s)
+
+	if s == "" {
+		return "-"
+	}
+
+	return s
+}
+
+// openSyslogSink - sends RFC 5424 messages to syslog daemon over unix socket, datagram or stream one
+func openSyslogSink(cfg *Log) (*slog.Logger, io.Closer, error) {
+	address := cfg.Address
+	if address == "" {
+		address = DefaultSyslogAddress
+	}
+
+	conn, err := dialUnix(address)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hostname, _ := os.Hostname()
+	app := filepath.Base(os.Args[0])
+	pid := os.Getpid()
+
+	// datagram carries single message, stream needs framing: newline terminated messages, RFC 6587 section 3.4.2
+	stream := conn.LocalAddr().Network() == "unix"
+
+	w := &levelWriter{
+		write: func(level slog.Level, p []byte) error {
+			msg := FormatRFC5424(level, time.Now(), hostname, app, pid, p)
+			if stream {
+				msg = append(msg, '\n')
+			}
+
+			_, err := conn.Write(msg)
+
+			return err
+		},
+	}
+
+	logger := NewLogger(w, cfg)
+
+	return slog.New(levelHandler{Handler: logger.Handler(), w: w}), conn, nil
+}
+
+// openJournaldSink - sends messages with structured fields to journald over native protocol
+func openJournaldSink(cfg *Log) (*slog.Logger, io.Closer, error) {
+	address := cfg.Address
+	if address == "" {
+		address = JournaldAddress
+	}
+
+	conn, err := net.Dial("unixgram", address)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	h := &JournaldHandler{
+		w:     conn,
+		level: cfg.SlogLevel(),
+		fields: [][2]string{
+			{"SYSLOG_IDENTIFIER", filepath.Base(os.Args[0])},
+		},
+		mu: new(sync.Mutex),
+	}
+
+	return slog.New(h), conn, nil
+}
+
+// JournaldHandler - slog handler writing records as journald native protocol datagrams, attributes become journal fields
+type JournaldHandler struct {
+	w      io.Writer
+	level  slog.Level
+	fields [][2]string
+	prefix string
+	mu     *sync.Mutex
+}
+
+// Enabled - reports whether level is logged
+func (h *JournaldHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+// Handle - writes record as single datagram
+func (h *JournaldHandler) Handle(_ context.Context, r slog.Record) error {
+	fields := append([][2]string{
+		{"MESSAGE", r.Message},
+		{"PRIORITY", strconv.Itoa(syslogSeverity(r.Level))},
+	}, h.fields...)
+
+	r.Attrs(func(a slog.Attr) bool {
+		fields = appendJournaldFields(fields, h.prefix, a)
+
+		return true
+	})
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	_, err := h.w.Write(EncodeJournaldFields(fields))
+
+	return err
+}
+
+// WithAttrs - returns handler with attributes
+func (h *JournaldHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.fields = append([][2]string(nil), h.fields...)
+
+	for _, a := range attrs {
+		h2.fields = appendJournaldFields(h2.fields, h.prefix, a)
+	}
+
+	return &h2
+}
+
+// WithGroup - returns handler with group, group name prefixes field names
+func (h *JournaldHandler) WithGroup(name string) slog.Handler {
+	h2 := *h
+	h2.prefix = h.prefix + name + "_"
+
+	return &h2
+}
+
+// appendJournaldFields - converts attribute to journal fields, groups are flattened
+func appendJournaldFields(fields [][2]string, prefix string, a slog.Attr) [][2]string {
+	a.Value = a.Value.Resolve()
+
+	if a.Value.Kind() == slog.KindGroup {
+		for _, ga := range a.Value.Group() {
+			fields = appendJournaldFields(fields, prefix+a.Key+"_", ga)
+		}
+
+		return fields
+	}
+
+	if a.Equal(slog.Attr{}) {
+		return fields
+	}
+
+	return append(fields, [2]string{JournaldFieldName(prefix + a.Key), a.Value.String()})
+}
+
+// JournaldFieldName - journal field names are uppercase ASCII letters, digits and underscores, not starting with underscore or digit
+func JournaldFieldName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, key)
+
+	name = strings.TrimLeft(name, "_0123456789")
+	if name == "" {
+		name = "FIELD"
+	}
+
+	if len(name) > 64 {
+		name = name[:64]
+	}
+
+	return name
+}
+
+// EncodeJournaldFields - encodes fields in journald native protocol, multi-line values are length prefixed
+func EncodeJournaldFields(fields [][2]string) []byte {
+	var b bytes.Buffer
+
+	for _, f := range fields {
+		if !strings.Contains(f[1], "\n") {
+			b.WriteString(f[0] + "=" + f[1] + "\n")
+
+			continue
+		}
+
+		b.WriteString(f[0] + "\n")
+		_ = binary.Write(&b, binary.LittleEndian, uint64(len(f[1])))
+		b.WriteString(f[1] + "\n")
+	}
+
+	return b.Bytes()
+}
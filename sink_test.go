@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFormatRFC5424(t *testing.T) {
+	ts := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	got := string(FormatRFC5424(slog.LevelError, ts, "hv 1", "qemu", 42, []byte("msg=hook")))
+	want := "<27>1 2026-01-02T03:04:05Z hv1 qemu 42 - - msg=hook"
+
+	if got != want {
+		t.Errorf("\n Got : %s\n Want: %s\n", got, want)
+	}
+}
+
+func TestJournaldHandler(t *testing.T) {
+	var buf bytes.Buffer
+
+	h := &JournaldHandler{
+		w:      &buf,
+		level:  slog.LevelInfo,
+		fields: [][2]string{{"SYSLOG_IDENTIFIER", "qemu"}},
+		mu:     new(sync.Mutex),
+	}
+
+	logger := slog.New(h).With("domain", "vm1", "sub-operation", "begin")
+	logger.Debug("skipped")
+	logger.WithGroup("cmd").Info("multi\nline", "exit_code", 2)
+
+	want := "MESSAGE\n\x0a\x00\x00\x00\x00\x00\x00\x00multi\nline\n" +
+		"PRIORITY=6\n" +
+		"SYSLOG_IDENTIFIER=qemu\n" +
+		"DOMAIN=vm1\n" +
+		"SUB_OPERATION=begin\n" +
+		"CMD_EXIT_CODE=2\n"
+
+	if buf.String() != want {
+		t.Errorf("\n Got : %q\n Want: %q\n", buf.String(), want)
+	}
+}
+
+func TestOpenLogSinkFallback(t *testing.T) {
+	cases := []struct {
+		caseDescription string
+		cfg             *Log
+		path            string
+		fallback        bool
+	}{
+		{"file sink", nil, filepath.Join(t.TempDir(), "qemu-hook.log"), false},
+		{"missing log directory", nil, filepath.Join(t.TempDir(), "missing", "qemu-hook.log"), true},
+		{"missing syslog socket", &Log{Sink: "syslog", Address: filepath.Join(t.TempDir(), "log")}, "", true},
+		{"missing journald socket", &Log{Sink: "journald", Address: filepath.Join(t.TempDir(), "socket")}, "", true},
+		{"stderr sink", &Log{Sink: "stderr"}, "", false},
+	}
+
+	for _, testCase := range cases {
+		logger, closer, err := OpenLogSink(testCase.cfg, testCase.path)
+		if logger == nil || closer == nil {
+			t.Fatalf("TestCase: %s\n Got : nil logger\n Want: usable logger", testCase.caseDescription)
+		}
+
+		_ = closer.Close()
+
+		if (err != nil) != testCase.fallback {
+			t.Errorf("TestCase: %s\n Got : %v\n Want: fallback %t", testCase.caseDescription, err, testCase.fallback)
+		}
+
+		if err != nil && !strings.Contains(err.Error(), "stderr") {
+			t.Errorf("TestCase: %s\n Got : %s\n Want: stderr fallback", testCase.caseDescription, err)
+		}
+	}
+}
+
+func TestSyslogSinkStream(t *testing.T) {
+	address := filepath.Join(t.TempDir(), "log")
+
+	ln, err := net.Listen("unix", address)
+	if err != nil {
+		t.Skipf("no unix stream listener: %s", err)
+	}
+	defer ln.Close()
+
+	logger, closer, err := OpenLogSink(&Log{Sink: "syslog", Address: address}, "")
+	if err != nil {
+		t.Fatalf("Got : %s\n Want: nil", err)
+	}
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	logger.Info("first")
+	logger.Warn("second")
+
+	_ = closer.Close()
+
+	data, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// messages are newline terminated on stream socket, so receiver can split them
+	lines := strings.SplitAfter(string(data), "\n")
+	if len(lines) != 3 || lines[2] != "" {
+		t.Fatalf("Got : %q\n Want: two newline terminated messages", data)
+	}
+
+	for i, want := range []string{"<30>1 ", "<28>1 "} {
+		if !strings.HasPrefix(lines[i], want) || !strings.HasSuffix(lines[i], "\n") {
+			t.Errorf("TestCase: message %d\n Got : %q\n Want: prefix %q and newline", i, lines[i], want)
+		}
+	}
+}
@@ -26,9 +26,9 @@ func SysctlGet(path string) (string, error) {
 }
 
 // SysctlCheckEqual - wrapper to compare supplied value with value in systcl file
-func SysctlCheckEqual(path string, value string) (bool, error) {
+func (s *System) SysctlCheckEqual(path string, value string) (bool, error) {
 	// get current value
-	currentValue, err := SysctlGet(filepath.Clean(path))
+	currentValue, err := s.Sysctl.Get(filepath.Clean(path))
 	if err != nil {
 		return false, err
 	}
@@ -42,9 +42,9 @@ func SysctlCheckEqual(path string, value string) (bool, error) {
 }
 
 // SysctlSet - wrapper to set sysctl file value
-func SysctlSet(path string, value string) error {
+func (s *System) SysctlSet(path string, value string) error {
 	// check the need to update sysctl file
-	ok, err := SysctlCheckEqual(filepath.Clean(path), value)
+	ok, err := s.SysctlCheckEqual(filepath.Clean(path), value)
 	if err != nil {
 		return err
 	}
@@ -54,19 +54,19 @@ func SysctlSet(path string, value string) error {
 		return nil
 	}
 
-	return os.WriteFile(filepath.Clean(path), []byte(value), 0)
+	return s.Sysctl.Set(filepath.Clean(path), value)
 }
 
 // EnableIPv4ForwardingOnInterface - enables IPv4 forwarding on specified interface
-func EnableIPv4ForwardingOnInterface(dev string) error {
+func (s *System) EnableIPv4ForwardingOnInterface(dev string) error {
 	// prefix for errors logging
 	const errPrefix = "sysctl config error:"
 
 	// enable IPv4 forwarding: sysctl -w net.ipv4.conf.%s.forwarding=1
-	err := SysctlSet(fmt.Sprintf("/proc/sys/net/ipv4/conf/%s/forwarding", SanitizeInput(dev)), "1")
+	err := s.SysctlSet(fmt.Sprintf("/proc/sys/net/ipv4/conf/%s/forwarding", SanitizeInput(dev)), "1")
 	if err != nil {
 		e := fmt.Errorf("%s failed to enable IPv4 forwarding for '%s' device: %s", errPrefix, SanitizeInput(dev), err.Error())
-		Logger.Println(e)
+		s.logger().Error(e.Error())
 
 		return e
 	}
@@ -75,24 +75,31 @@ func EnableIPv4ForwardingOnInterface(dev string) error {
 }
 
 // EnableIPv6ForwardingOnInterface - enables IPv6 forwarding on specified interface
-func EnableIPv6ForwardingOnInterface(dev string) error {
+func (s *System) EnableIPv6ForwardingOnInterface(dev string) error {
 	// prefix for errors logging
 	const errPrefix = "sysctl config error:"
 
 	// enable IPv6 forwarding: sysctl -w net.ipv6.conf.%s.forwarding=1
-	err := SysctlSet(fmt.Sprintf("/proc/sys/net/ipv6/conf/%s/forwarding", SanitizeInput(dev)), "1")
+	err := s.SysctlSet(fmt.Sprintf("/proc/sys/net/ipv6/conf/%s/forwarding", SanitizeInput(dev)), "1")
 	if err != nil {
 		e := fmt.Errorf("%s failed to enable IPv6 forwarding for '%s' device: %s", errPrefix, SanitizeInput(dev), err.Error())
-		Logger.Println(e)
+		s.logger().Error(e.Error())
 
 		return e
 	}
 
+	// serialize with concurrent hook invocations, global sysctl is shared between VMs
+	unlock, err := s.Lock("sysctl:net.ipv6.conf.all.forwarding")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	// enable IPv6 forwarding globally, this differs from IPv4 behavior, consult kernel docs: sysctl -w net.ipv6.conf.all.forwarding=1
-	err = SysctlSet("/proc/sys/net/ipv6/conf/all/forwarding", "1")
+	err = s.SysctlSet("/proc/sys/net/ipv6/conf/all/forwarding", "1")
 	if err != nil {
 		e := fmt.Errorf("%s failed to enable IPv6 forwarding: %s", errPrefix, err.Error())
-		Logger.Println(e)
+		s.logger().Error(e.Error())
 
 		return e
 	}
@@ -101,15 +108,15 @@ func EnableIPv6ForwardingOnInterface(dev string) error {
 }
 
 // EnableIPv4ProxyARPOnInterface - enables IPv4 ProxyARP on specified interface
-func EnableIPv4ProxyARPOnInterface(dev string) error {
+func (s *System) EnableIPv4ProxyARPOnInterface(dev string) error {
 	// prefix for errors logging
 	const errPrefix = "sysctl config error:"
 
 	// enable IPv4 ProxyARP: sysctl -w net.ipv4.conf.%s.proxy_arp=1
-	err := SysctlSet(fmt.Sprintf("/proc/sys/net/ipv4/conf/%s/proxy_arp", SanitizeInput(dev)), "1")
+	err := s.SysctlSet(fmt.Sprintf("/proc/sys/net/ipv4/conf/%s/proxy_arp", SanitizeInput(dev)), "1")
 	if err != nil {
 		e := fmt.Errorf("%s failed to enable IPv4 ProxyARP for '%s' device: %s", errPrefix, SanitizeInput(dev), err.Error())
-		Logger.Println(e)
+		s.logger().Error(e.Error())
 
 		return e
 	}
@@ -118,15 +125,15 @@ func EnableIPv4ProxyARPOnInterface(dev string) error {
 }
 
 // EnableIPv6ProxyNDPOnInterface - enables IPv6 ProxyNDP on specified interface
-func EnableIPv6ProxyNDPOnInterface(dev string) error {
+func (s *System) EnableIPv6ProxyNDPOnInterface(dev string) error {
 	// prefix for errors logging
 	const errPrefix = "sysctl config error:"
 
 	// enable IPv6 ProxyNDP: sysctl -w net.ipv6.conf.%s.proxy_ndp=1
-	err := SysctlSet(fmt.Sprintf("/proc/sys/net/ipv6/conf/%s/proxy_ndp", SanitizeInput(dev)), "1")
+	err := s.SysctlSet(fmt.Sprintf("/proc/sys/net/ipv6/conf/%s/proxy_ndp", SanitizeInput(dev)), "1")
 	if err != nil {
 		e := fmt.Errorf("%s failed to enable IPv6 ProxyNDP for '%s' device: %s", errPrefix, SanitizeInput(dev), err.Error())
-		Logger.Println(e)
+		s.logger().Error(e.Error())
 
 		return e
 	}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Runner - runs external commands
+type Runner interface {
+	Run(name string, arg ...string) RunCommandOutput
+}
+
+// SysctlStore - reads and writes sysctl files
+type SysctlStore interface {
+	Get(path string) (string, error)
+	Set(path string, value string) error
+}
+
+// ExecRunner - Runner executing commands on host node, within hook context
+type ExecRunner struct{}
+
+// Run - runs command with RunCommand
+func (ExecRunner) Run(name string, arg ...string) RunCommandOutput {
+	return RunCommand(name, arg...)
+}
+
+// ProcSysctl - SysctlStore backed by files under `/proc/sys`
+type ProcSysctl struct{}
+
+// Get - reads value from sysctl file
+func (ProcSysctl) Get(path string) (string, error) {
+	return SysctlGet(path)
+}
+
+// Set - writes value to sysctl file
+func (ProcSysctl) Set(path string, value string) error {
+	return os.WriteFile(filepath.Clean(path), []byte(value), 0)
+}
+
+// System - external dependencies of hook functions
+type System struct {
+	Runner  Runner
+	Sysctl  SysctlStore
+	Packets PacketSender
+	// waits between repeated actions, time.Sleep when not set
+	Sleep func(time.Duration)
+	// runtime directory, for locks and state
+	RunDir string
+	// logger with step context, global Logger when not set
+	Log *slog.Logger
+}
+
+// NewSystem - returns System operating on host node
+func NewSystem() *System {
+	return &System{
+		Runner:  ExecRunner{},
+		Sysctl:  ProcSysctl{},
+		Packets: RawSocket{},
+		Sleep:   time.Sleep,
+		RunDir:  HookRunDir,
+	}
+}
+
+// Step - returns System logging with hook step name
+func (s *System) Step(name string) *System {
+	step := *s
+	step.Log = s.logger().With("step", name)
+
+	return &step
+}
+
+// logger - returns step logger
+func (s *System) logger() *slog.Logger {
+	if s.Log == nil {
+		return Logger
+	}
+
+	return s.Log
+}
+
+// sleep - waits with Sleep, returns false when hook is canceled before or while waiting
+func (s *System) sleep(d time.Duration) bool {
+	if HookContext.Err() != nil {
+		return false
+	}
+
+	if s.Sleep != nil {
+		s.Sleep(d)
+
+		return HookContext.Err() == nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-HookContext.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// run - runs command with Runner, logs command, exit code and duration
+func (s *System) run(name string, arg ...string) RunCommandOutput {
+	cmd := s.Runner.Run(name, arg...)
+
+	s.logger().Debug("command",
+		"command", cmd.Command,
+		"exit_code", cmd.ReturnCode,
+		"duration", cmd.Duration,
+	)
+
+	return cmd
+}
+
+// Refs - tracks running domains using shared devices
+func (s *System) Refs() RefCounter {
+	return RefCounter{Dir: filepath.Join(s.RunDir, "refcount")}
+}
+
+// Active - tracks domains between `prepare begin` and `release end`, keyed and used by domain UUID
+func (s *System) Active() RefCounter {
+	return RefCounter{Dir: filepath.Join(s.RunDir, "active")}
+}
+
+// IsInterfaceExists - check interface existence
+func (s *System) IsInterfaceExists(name string) bool {
+	cmd := s.run("ip", "link", "show", "dev", SanitizeInput(name))
+
+	return cmd.ReturnCode == 0
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"path"
 	"regexp"
 	"strings"
 
@@ -12,8 +13,12 @@ func IsValidInterfaceName(fl validator.FieldLevel) bool {
 	return regexp.MustCompile("^([a-zA-Z0-9-]{1,15})$").MatchString(fl.Field().String())
 }
 
-// IsNotIPv6NetworkAddress - validates that IPv6 is not network address for /64 of it self
+// IsNotIPv6NetworkAddress - validates that IPv6 is not network address for /64 of it self, network address is free for VM with link-local gateway
 func IsNotIPv6NetworkAddress(fl validator.FieldLevel) bool {
+	if l3 := parentL3(fl.Parent()); l3 != nil && l3.Gateway.ModelV6() != GatewayNetwork {
+		return true
+	}
+
 	// store input IPv6
 	ipv6 := fl.Field().String()
 	// compute GW for /64
@@ -21,3 +26,22 @@ func IsNotIPv6NetworkAddress(fl validator.FieldLevel) bool {
 	// compare
 	return !strings.EqualFold(ipv6, gw6)
 }
+
+// IsValidInterfaceNameTemplate - validates naming template, every name it renders must pass `iface` validation
+func IsValidInterfaceNameTemplate(fl validator.FieldLevel) bool {
+	return CheckNameTemplate(fl.Field().String()) == nil
+}
+
+// IsValidGlob - validates shell glob pattern
+func IsValidGlob(fl validator.FieldLevel) bool {
+	_, err := path.Match(fl.Field().String(), "")
+
+	return err == nil
+}
+
+// IsValidRegexp - validates regular expression
+func IsValidRegexp(fl validator.FieldLevel) bool {
+	_, err := regexp.Compile(fl.Field().String())
+
+	return err == nil
+}